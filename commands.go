@@ -0,0 +1,191 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+	"timelapse_maker/constants"
+	"timelapse_maker/jobs"
+)
+
+// runCommand executes an on-demand command instead of starting the scheduler.
+func runCommand(args []string) {
+	switch args[0] {
+	case "season-comparison":
+		seasonComparisonCommand(args[1:])
+	case "ingest":
+		ingestCommand(args[1:])
+	case "coverage":
+		coverageCommand(args[1:])
+	case "render":
+		renderCommand(args[1:])
+	case "reset-reference":
+		resetReferenceCommand(args[1:])
+	default:
+		log.Fatalf("Unknown command %s", args[0])
+	}
+}
+
+func seasonComparisonCommand(args []string) {
+	flags := flag.NewFlagSet("season-comparison", flag.ExitOnError)
+	timeOfDay := flags.String("time", "12:00", "time of day to pick frames at, HH:MM")
+	from := flags.String("from", "", "first day, YYYY-MM-DD")
+	to := flags.String("to", "", "last day, YYYY-MM-DD")
+	compareYear := flags.Int("compare-year", 0, "year to stack next to the range, 0 to disable")
+	tolerance := flags.Duration("tolerance", seasonComparisonJob.Tolerance, "max distance between a frame and the time of day")
+	_ = flags.Parse(args)
+
+	comparison := jobs.SeasonComparison{CompareYear: *compareYear, Tolerance: *tolerance}
+	var err error
+	if comparison.TimeOfDay, err = parseTimeOfDay(*timeOfDay); err != nil {
+		log.Fatalf("Invalid -time: %v", err)
+	}
+	if comparison.From, err = time.ParseInLocation("2006-01-02", *from, time.Local); err != nil {
+		log.Fatalf("Invalid -from: %v", err)
+	}
+	if comparison.To, err = time.ParseInLocation("2006-01-02", *to, time.Local); err != nil {
+		log.Fatalf("Invalid -to: %v", err)
+	}
+
+	path, err := seasonComparisonJob.Compare(comparison)
+	if err != nil {
+		log.Fatalf("Season comparison failed: %v", err)
+	}
+	log.Printf("Season comparison saved to %s", path)
+}
+
+// ingestCommand imports frames from another source into a camera's image tree.
+// The capture time is taken from the file name when it follows the frame
+// naming, from the modification time otherwise.
+func ingestCommand(args []string) {
+	flags := flag.NewFlagSet("ingest", flag.ExitOnError)
+	cameraName := flags.String("camera", mainCamera.Name, "camera the frames belong to")
+	typeName := flags.String("type", constants.Day.Name, "timelapse type whose image tree receives the frames")
+	source := flags.String("source", "", "directory with the frames to import")
+	_ = flags.Parse(args)
+
+	camera, found := findCamera(*cameraName)
+	if !found {
+		log.Fatalf("Unknown camera %s", *cameraName)
+	}
+	var timelapseType *constants.TimelapseType
+	for _, element := range downloadSchedules {
+		if element.TimelapseType.Name == *typeName {
+			timelapseType = element.TimelapseType
+		}
+	}
+	if timelapseType == nil {
+		log.Fatalf("Unknown timelapse type %s", *typeName)
+	}
+	entries, err := os.ReadDir(*source)
+	if err != nil {
+		log.Fatalf("Unable to read %s: %v", *source, err)
+	}
+
+	ingest := ingestFor(camera, timelapseType)
+	imported := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		capturedAt, err := time.ParseInLocation(jobs.FrameNameLayout, entry.Name(), time.Local)
+		if err != nil {
+			info, err := entry.Info()
+			if err != nil {
+				log.Printf("Skipping %s: %v", entry.Name(), err)
+				continue
+			}
+			capturedAt = info.ModTime()
+		}
+		if _, err = ingest.IngestFile(filepath.Join(*source, entry.Name()), camera.ImagesRootDirectory, timelapseType, capturedAt); err != nil {
+			log.Printf("Skipping %s: %v", entry.Name(), err)
+			continue
+		}
+		imported++
+	}
+	log.Printf("Imported %d of %d files into camera %s", imported, len(entries), camera.Name)
+}
+
+func coverageCommand(args []string) {
+	flags := flag.NewFlagSet("coverage", flag.ExitOnError)
+	typeName := flags.String("type", constants.Day.Name, "timelapse type of the period")
+	period := flags.String("period", "", "period to report on, named like its image directory")
+	_ = flags.Parse(args)
+
+	for _, element := range videoJobs {
+		if element.VideoMakerJob.TimelapseType.Name != *typeName {
+			continue
+		}
+		report, err := element.VideoMakerJob.CoverageReport(*period)
+		if err != nil {
+			log.Fatalf("Unable to report coverage: %v", err)
+		}
+		log.Printf("Coverage of %s %s: %s", *typeName, *period, report)
+		for _, gap := range report.Gaps {
+			log.Printf("Gap %s - %s: %d slots missing", gap.From.Format(time.RFC3339), gap.To.Format(time.RFC3339), gap.Missing)
+		}
+		return
+	}
+	log.Fatalf("Unknown timelapse type %s", *typeName)
+}
+
+// renderCommand renders a period in the foreground; -force accepts a coverage
+// below the threshold and unblocks a blocked render. A render the daemon is
+// driving at the time is left to it.
+func renderCommand(args []string) {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	typeName := flags.String("type", constants.Day.Name, "timelapse type of the period")
+	period := flags.String("period", "", "period to render, named like its image directory")
+	force := flags.Bool("force", false, "render even if the coverage is below coverage-min-percent")
+	_ = flags.Parse(args)
+
+	for _, element := range videoJobs {
+		maker := element.VideoMakerJob
+		if maker.TimelapseType.Name != *typeName {
+			continue
+		}
+		maker.Queue = nil
+		if *force {
+			maker.Force(*period)
+		} else {
+			maker.Render(*period)
+		}
+		return
+	}
+	log.Fatalf("Unknown timelapse type %s", *typeName)
+}
+
+func findCamera(name string) (jobs.Camera, bool) {
+	for _, camera := range append([]jobs.Camera{mainCamera}, extraCameras...) {
+		if camera.Name == name {
+			return camera, true
+		}
+	}
+	return jobs.Camera{}, false
+}
+
+func resetReferenceCommand(args []string) {
+	flags := flag.NewFlagSet("reset-reference", flag.ExitOnError)
+	cameraName := flags.String("camera", mainCamera.Name, "camera whose reference frame is reset")
+	_ = flags.Parse(args)
+
+	camera, found := findCamera(*cameraName)
+	if !found {
+		log.Fatalf("Unknown camera %s", *cameraName)
+	}
+	if err := jobs.ResetReference(camera.ImagesRootDirectory); err != nil {
+		log.Fatalf("Unable to reset reference frame: %v", err)
+	}
+	log.Printf("Reference frame of camera %s reset, the next captured frame becomes the reference", camera.Name)
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hours, &minutes); err != nil {
+		return 0, err
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
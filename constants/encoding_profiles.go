@@ -0,0 +1,49 @@
+package constants
+
+type EncodingProfile struct {
+	Name             string
+	Framerate        int
+	Crf              int
+	Width            int
+	Height           int
+	Encoder          string //ffmpeg encoder name
+	CodecName        string //codec name as reported by ffprobe
+	VideoFadeSeconds float64
+	Audio            *AudioSettings
+}
+
+// AudioSettings adds a background track to a profile. File wins over Directory;
+// with Directory the tracks rotate day by day in name order.
+type AudioSettings struct {
+	File        string
+	Directory   string
+	FadeSeconds float64
+	Bitrate     string
+}
+
+var DefaultProfile = EncodingProfile{
+	Name:      "default",
+	Framerate: 5,
+	Crf:       28,
+	Width:     1280,
+	Height:    720,
+	Encoder:   "libx265",
+	CodecName: "hevc",
+}
+
+// DailyProfile encodes like DefaultProfile, kept apart so that the published
+// daily videos can get their own fades and audio.
+var DailyProfile = EncodingProfile{
+	Name:      "daily",
+	Framerate: 5,
+	Crf:       28,
+	Width:     1280,
+	Height:    720,
+	Encoder:   "libx265",
+	CodecName: "hevc",
+}
+
+var EncodingProfiles = map[string]*EncodingProfile{
+	DefaultProfile.Name: &DefaultProfile,
+	DailyProfile.Name:   &DailyProfile,
+}
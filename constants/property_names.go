@@ -4,4 +4,84 @@ var (
 	ImageUrl      = "image-url"
 	BaseDirectory = "base-directory"
 	DBUrl         = "database-url"
+
+	CameraName       = "camera-name"
+	Cameras          = "cameras"
+	CameraImageUrl   = "camera.%s.image-url"
+	CameraMasks      = "camera.%s.masks"
+	CameraMaskStyle  = "camera.%s.mask-style"
+	CameraCrop       = "camera.%s.crop"
+	CameraResize     = "camera.%s.resize"
+	CameraTypeCrop   = "camera.%s.%s.crop"
+	CameraTypeResize = "camera.%s.%s.resize"
+
+	MosaicTypes     = "mosaic-types"
+	MosaicColumns   = "mosaic-columns"
+	MosaicTolerance = "mosaic-tolerance"
+
+	ProfileVideoFade    = "profile.%s.video-fade"
+	ProfileAudioFile    = "profile.%s.audio-file"
+	ProfileAudioDir     = "profile.%s.audio-directory"
+	ProfileAudioFade    = "profile.%s.audio-fade"
+	ProfileAudioBitrate = "profile.%s.audio-bitrate"
+
+	PreviewFrames   = "preview-frames"
+	PreviewWidth    = "preview-width"
+	PreviewDelay    = "preview-delay"
+	PreviewMaxBytes = "preview-max-bytes"
+
+	ContactSheetTypes     = "contact-sheet-types"
+	ContactSheetGrid      = "contact-sheet.%s.grid"
+	ContactSheetTileWidth = "contact-sheet.%s.tile-width"
+
+	HlsTypes          = "hls-types"
+	HlsSegmentSeconds = "hls-segment-seconds"
+	HlsSegmentType    = "hls-segment-type"
+	HlsLadder         = "hls-ladder"
+
+	RenderRetryInitialDelay = "render-retry-initial-delay"
+	RenderRetryMaxDelay     = "render-retry-max-delay"
+	RenderRetryMaxAttempts  = "render-retry-max-attempts"
+
+	RenderWorkers = "render-workers"
+	RenderNice    = "render-nice"
+	RenderThreads = "render-threads"
+
+	MetricsAddress = "metrics-address"
+
+	ChunkedEncodingTypes     = "chunked-encoding-types"
+	ChunkedEncodingChunks    = "chunked-encoding-chunks"
+	ChunkedEncodingWorkers   = "chunked-encoding-workers"
+	ChunkedEncodingMinFrames = "chunked-encoding-min-frames"
+
+	YearCompilationSchedule = "year-compilation-schedule"
+
+	SeasonComparisonSchedule     = "season-comparison-schedule"
+	SeasonComparisonTime         = "season-comparison-time"
+	SeasonComparisonDays         = "season-comparison-days"
+	SeasonComparisonCompareYears = "season-comparison-compare-years"
+	SeasonComparisonTolerance    = "season-comparison-tolerance"
+
+	TitleCardTypes   = "title-card-types"
+	TitleCardSeconds = "title-card-seconds"
+	OutroImage       = "outro-image"
+
+	HighlightTypes       = "highlight-types"
+	HighlightSensitivity = "highlight-sensitivity"
+	HighlightMinFrames   = "highlight-min-frames"
+	HighlightMergeFrames = "highlight-merge-frames"
+	HighlightMaxClips    = "highlight-max-clips"
+
+	BestFrameTypes  = "best-frame-types"
+	BestFrameBucket = "best-frame-bucket"
+
+	CameraMovementTypes    = "camera-movement-types"
+	CameraMovementShift    = "camera-movement-shift"
+	CameraMovementRotation = "camera-movement-rotation"
+	CameraMovementWebhook  = "camera-movement-webhook"
+
+	CoverageTypes      = "coverage-types"
+	CoverageTolerance  = "coverage-tolerance"
+	CoverageMaxGaps    = "coverage-max-gaps"
+	CoverageMinPercent = "coverage-min-percent"
 )
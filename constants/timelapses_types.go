@@ -9,18 +9,94 @@ type TimelapseType struct {
 	Name               string
 	Directory          string
 	SubDirectoryNaming func(t time.Time) string
+	PeriodBounds       func(name string) (start time.Time, end time.Time, err error)
+	SummaryImages      bool
+	MaxRenderDuration  time.Duration
+	Profile            *EncodingProfile
+	RenderPriority     int //higher renders first when renders queue up
 }
 
-var Day = TimelapseType{"DAY", "days_of_year", func(t time.Time) string {
-	return t.Format("2006-01-02")
-}}
-var Week = TimelapseType{"WEEK", "weeks_of_year", func(t time.Time) string {
-	year, week := t.ISOWeek()
-	return fmt.Sprintf("%d-W%d", year, week)
-}}
-var Month = TimelapseType{"MONTH", "months_of_year", func(t time.Time) string {
-	return t.Format("2006-01")
-}}
-var Quarter = TimelapseType{"QUARTER", "quarters_of_year", func(t time.Time) string {
-	return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())+2)/3)
-}}
+var Day = TimelapseType{
+	Name:      "DAY",
+	Directory: "days_of_year",
+	SubDirectoryNaming: func(t time.Time) string {
+		return t.Format("2006-01-02")
+	},
+	PeriodBounds: func(name string) (time.Time, time.Time, error) {
+		start, err := time.ParseInLocation("2006-01-02", name, time.Local)
+		return start, start.AddDate(0, 0, 1), err
+	},
+	SummaryImages:     true,
+	MaxRenderDuration: time.Hour,
+	Profile:           &DailyProfile,
+	RenderPriority:    4,
+}
+var Week = TimelapseType{
+	Name:      "WEEK",
+	Directory: "weeks_of_year",
+	SubDirectoryNaming: func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%d", year, week)
+	},
+	PeriodBounds: func(name string) (time.Time, time.Time, error) {
+		var year, week int
+		if _, err := fmt.Sscanf(name, "%d-W%d", &year, &week); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		// January 4th always falls into the first ISO week
+		jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.Local)
+		daysSinceMonday := (int(jan4.Weekday()) + 6) % 7
+		start := jan4.AddDate(0, 0, (week-1)*7-daysSinceMonday)
+		return start, start.AddDate(0, 0, 7), nil
+	},
+	MaxRenderDuration: 2 * time.Hour,
+	Profile:           &DefaultProfile,
+	RenderPriority:    3,
+}
+var Month = TimelapseType{
+	Name:      "MONTH",
+	Directory: "months_of_year",
+	SubDirectoryNaming: func(t time.Time) string {
+		return t.Format("2006-01")
+	},
+	PeriodBounds: func(name string) (time.Time, time.Time, error) {
+		start, err := time.ParseInLocation("2006-01", name, time.Local)
+		return start, start.AddDate(0, 1, 0), err
+	},
+	MaxRenderDuration: 4 * time.Hour,
+	Profile:           &DefaultProfile,
+	RenderPriority:    2,
+}
+var Quarter = TimelapseType{
+	Name:      "QUARTER",
+	Directory: "quarters_of_year",
+	SubDirectoryNaming: func(t time.Time) string {
+		return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())+2)/3)
+	},
+	PeriodBounds: func(name string) (time.Time, time.Time, error) {
+		var year, quarter int
+		if _, err := fmt.Sscanf(name, "%d-Q%d", &year, &quarter); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		start := time.Date(year, time.Month((quarter-1)*3+1), 1, 0, 0, 0, 0, time.Local)
+		return start, start.AddDate(0, 3, 0), nil
+	},
+	MaxRenderDuration: 8 * time.Hour,
+	Profile:           &DefaultProfile,
+	RenderPriority:    1,
+}
+
+// Year has no image tree of its own, it is compiled from the days of the year.
+var Year = TimelapseType{
+	Name:      "YEAR",
+	Directory: "years",
+	SubDirectoryNaming: func(t time.Time) string {
+		return t.Format("2006")
+	},
+	PeriodBounds: func(name string) (time.Time, time.Time, error) {
+		start, err := time.ParseInLocation("2006", name, time.Local)
+		return start, start.AddDate(1, 0, 0), err
+	},
+	MaxRenderDuration: 2 * time.Hour,
+	Profile:           &DefaultProfile,
+}
@@ -6,6 +6,7 @@ require (
 	github.com/jackc/pgx/v4 v4.14.0
 	github.com/magiconair/properties v1.8.5
 	github.com/u2takey/ffmpeg-go v0.3.0
+	golang.org/x/image v0.0.0-20211028202545-6944b10bf410
 )
 
 require (
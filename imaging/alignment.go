@@ -0,0 +1,131 @@
+package imaging
+
+import (
+	"image"
+	"math"
+)
+
+// Alignment is how far a frame is displaced from a reference frame. Shifts
+// are in pixels of the reference frame, rotation in degrees.
+type Alignment struct {
+	ShiftX   float64
+	ShiftY   float64
+	Rotation float64
+	Score    float64 //normalized correlation of the edge maps at the best match, 1 is a perfect match
+}
+
+func (a Alignment) Shift() float64 {
+	return math.Hypot(a.ShiftX, a.ShiftY)
+}
+
+type edgeMap struct {
+	width, height int
+	values        []float64
+}
+
+// EdgeMap returns the Sobel gradient magnitude of img scaled down to
+// sampleWidth. Edges survive changes of light far better than raw pixels.
+func EdgeMap(img image.Image, sampleWidth int) edgeMap {
+	gray := Grayscale(img, sampleWidth)
+	width, height := gray.Rect.Dx(), gray.Rect.Dy()
+	edges := edgeMap{width: width, height: height, values: make([]float64, width*height)}
+	at := func(x, y int) float64 {
+		return float64(gray.Pix[y*gray.Stride+x])
+	}
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			edges.values[y*width+x] = math.Hypot(gx, gy)
+		}
+	}
+	return edges
+}
+
+// rotate turns the edge map by degrees around its centre, nearest neighbour.
+// Pixels rotated in from outside are marked with -1 so they are not compared.
+func (e edgeMap) rotate(degrees float64) edgeMap {
+	if degrees == 0 {
+		return e
+	}
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	cx, cy := float64(e.width-1)/2, float64(e.height-1)/2
+	rotated := edgeMap{width: e.width, height: e.height, values: make([]float64, len(e.values))}
+	for y := 0; y < e.height; y++ {
+		for x := 0; x < e.width; x++ {
+			dx, dy := float64(x)-cx, float64(y)-cy
+			sx := int(math.Round(cx + dx*cos + dy*sin))
+			sy := int(math.Round(cy - dx*sin + dy*cos))
+			if sx < 0 || sy < 0 || sx >= e.width || sy >= e.height {
+				rotated.values[y*e.width+x] = -1
+				continue
+			}
+			rotated.values[y*e.width+x] = e.values[sy*e.width+sx]
+		}
+	}
+	return rotated
+}
+
+// correlate returns the normalized correlation of reference and current with
+// current moved by dx, dy, over the region where both are defined.
+func correlate(reference edgeMap, current edgeMap, dx int, dy int) float64 {
+	var ab, aa, bb float64
+	for y := 0; y < reference.height; y++ {
+		cy := y + dy
+		if cy < 0 || cy >= current.height {
+			continue
+		}
+		for x := 0; x < reference.width; x++ {
+			cx := x + dx
+			if cx < 0 || cx >= current.width {
+				continue
+			}
+			b := current.values[cy*current.width+cx]
+			if b < 0 {
+				continue
+			}
+			a := reference.values[y*reference.width+x]
+			ab += a * b
+			aa += a * a
+			bb += b * b
+		}
+	}
+	if aa == 0 || bb == 0 {
+		return 0
+	}
+	return ab / math.Sqrt(aa*bb)
+}
+
+// EstimateAlignment searches the shift (up to maxShift sample pixels) and
+// rotation (up to maxRotation degrees, in rotationStep steps) that best maps
+// current onto reference.
+func EstimateAlignment(reference image.Image, current image.Image, sampleWidth int, maxShift int,
+	maxRotation float64, rotationStep float64) Alignment {
+	referenceEdges := EdgeMap(reference, sampleWidth)
+	currentEdges := EdgeMap(current, sampleWidth)
+	if referenceEdges.width != currentEdges.width || referenceEdges.height != currentEdges.height {
+		return Alignment{}
+	}
+
+	best := Alignment{Score: -1}
+	var bestDx, bestDy int
+	for rotation := -maxRotation; rotation <= maxRotation+rotationStep/2; rotation += rotationStep {
+		rotated := currentEdges.rotate(rotation)
+		for dy := -maxShift; dy <= maxShift; dy++ {
+			for dx := -maxShift; dx <= maxShift; dx++ {
+				score := correlate(referenceEdges, rotated, dx, dy)
+				if score > best.Score {
+					best = Alignment{Rotation: rotation, Score: score}
+					bestDx, bestDy = dx, dy
+				}
+			}
+		}
+		if rotationStep <= 0 {
+			break
+		}
+	}
+	scale := float64(reference.Bounds().Dx()) / float64(sampleWidth)
+	best.ShiftX = float64(bestDx) * scale
+	best.ShiftY = float64(bestDy) * scale
+	return best
+}
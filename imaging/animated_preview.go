@@ -0,0 +1,37 @@
+package imaging
+
+import (
+	"errors"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"log"
+
+	"golang.org/x/image/draw"
+)
+
+// AnimatedPreview scales every frame to the given width and quantizes it to the
+// Plan 9 palette, looping forever with delay hundredths of a second per frame.
+func AnimatedPreview(frames []string, width int, delay int) (*gif.GIF, error) {
+	preview := &gif.GIF{LoopCount: 0}
+	for _, frame := range frames {
+		img, err := LoadImage(frame)
+		if err != nil {
+			log.Printf("Skipping %s in preview: %v", frame, err)
+			continue
+		}
+		bounds := img.Bounds()
+		height := bounds.Dy() * width / bounds.Dx()
+		scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+
+		paletted := image.NewPaletted(scaled.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), scaled, image.Point{})
+		preview.Image = append(preview.Image, paletted)
+		preview.Delay = append(preview.Delay, delay)
+	}
+	if len(preview.Image) == 0 {
+		return nil, errors.New("no decodable frames for preview")
+	}
+	return preview, nil
+}
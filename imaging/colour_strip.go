@@ -0,0 +1,49 @@
+package imaging
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"log"
+)
+
+// ColourStrip draws one column per frame filled with the average colour of that
+// frame ("colour of the day").
+func ColourStrip(frames []string, height int) (*image.RGBA, error) {
+	strip := image.NewRGBA(image.Rect(0, 0, len(frames), height))
+	decoded := 0
+	for i, frame := range frames {
+		img, err := LoadImage(frame)
+		if err != nil {
+			log.Printf("Skipping %s in colour strip: %v", frame, err)
+			continue
+		}
+		decoded++
+		average := AverageColour(img)
+		for y := 0; y < height; y++ {
+			strip.SetRGBA(i, y, average)
+		}
+	}
+	if decoded == 0 {
+		return nil, errors.New("no decodable frames for colour strip")
+	}
+	return strip, nil
+}
+
+func AverageColour(img image.Image) color.RGBA {
+	bounds := img.Bounds()
+	var r, g, b, count uint64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cr, cg, cb, _ := img.At(x, y).RGBA()
+			r += uint64(cr >> 8)
+			g += uint64(cg >> 8)
+			b += uint64(cb >> 8)
+			count++
+		}
+	}
+	if count == 0 {
+		return color.RGBA{A: 0xff}
+	}
+	return color.RGBA{R: uint8(r / count), G: uint8(g / count), B: uint8(b / count), A: 0xff}
+}
@@ -0,0 +1,67 @@
+package imaging
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"log"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	contactSheetLabelHeight = 20
+	contactSheetGap         = 4
+)
+
+// ContactSheet lays the given frames out in a grid of tiles tileWidth pixels
+// wide, filled row by row, with labels[i] printed under the i-th tile.
+func ContactSheet(frames []string, labels []string, columns int, tileWidth int) (*image.RGBA, error) {
+	if len(frames) == 0 || columns <= 0 || tileWidth <= 0 {
+		return nil, errors.New("nothing to put on contact sheet")
+	}
+	rows := (len(frames) + columns - 1) / columns
+
+	var sheet *image.RGBA
+	var tileHeight int
+	for i, frame := range frames {
+		img, err := LoadImage(frame)
+		if err != nil {
+			log.Printf("Skipping %s in contact sheet: %v", frame, err)
+			continue
+		}
+		if sheet == nil {
+			bounds := img.Bounds()
+			tileHeight = bounds.Dy() * tileWidth / bounds.Dx()
+			sheet = image.NewRGBA(image.Rect(0, 0,
+				columns*(tileWidth+contactSheetGap)+contactSheetGap,
+				rows*(tileHeight+contactSheetLabelHeight+contactSheetGap)+contactSheetGap))
+			draw.Draw(sheet, sheet.Bounds(), image.Black, image.Point{}, draw.Src)
+		}
+		x := contactSheetGap + (i%columns)*(tileWidth+contactSheetGap)
+		y := contactSheetGap + (i/columns)*(tileHeight+contactSheetLabelHeight+contactSheetGap)
+		tile := image.Rect(x, y, x+tileWidth, y+tileHeight)
+		draw.ApproxBiLinear.Scale(sheet, tile, img, img.Bounds(), draw.Src, nil)
+		if i < len(labels) {
+			DrawLabel(sheet, labels[i], image.Pt(x, y+tileHeight+contactSheetLabelHeight-6), color.White)
+		}
+	}
+	if sheet == nil {
+		return nil, errors.New("no decodable frames for contact sheet")
+	}
+	return sheet, nil
+}
+
+// DrawLabel writes text with its baseline starting at the given point.
+func DrawLabel(dst draw.Image, text string, baseline image.Point, colour color.Color) {
+	drawer := font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(colour),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(baseline.X, baseline.Y),
+	}
+	drawer.DrawString(text)
+}
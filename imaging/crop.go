@@ -0,0 +1,71 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// ParseRectangle reads "x,y,width,height"; an empty spec is the empty rectangle.
+func ParseRectangle(spec string) (image.Rectangle, error) {
+	if strings.TrimSpace(spec) == "" {
+		return image.Rectangle{}, nil
+	}
+	numbers, err := parseInts(spec, 4)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	if numbers[2] <= 0 || numbers[3] <= 0 {
+		return image.Rectangle{}, errors.New(fmt.Sprintf("rectangle %q must have a positive size", spec))
+	}
+	return image.Rect(numbers[0], numbers[1], numbers[0]+numbers[2], numbers[1]+numbers[3]), nil
+}
+
+// ParseSize reads "WIDTHxHEIGHT"; either side may be 0 to keep the aspect ratio.
+func ParseSize(spec string) (int, int, error) {
+	if strings.TrimSpace(spec) == "" {
+		return 0, 0, nil
+	}
+	var width, height int
+	if _, err := fmt.Sscanf(spec, "%dx%d", &width, &height); err != nil {
+		return 0, 0, errors.New(fmt.Sprintf("size %q must be WIDTHxHEIGHT: %v", spec, err))
+	}
+	if width < 0 || height < 0 || (width == 0 && height == 0) {
+		return 0, 0, errors.New(fmt.Sprintf("size %q must have a positive side", spec))
+	}
+	return width, height, nil
+}
+
+// CropAndResize cuts crop out of img, when it is not empty, and scales the
+// result to width x height. A zero side follows the aspect ratio of the crop.
+// A crop that does not fit inside the frame, e.g. one configured for another
+// resolution, is an error.
+func CropAndResize(img image.Image, crop image.Rectangle, width int, height int) (image.Image, error) {
+	bounds := img.Bounds()
+	if !crop.Empty() {
+		if !crop.Add(bounds.Min).In(bounds) {
+			return nil, errors.New(fmt.Sprintf("crop %v does not fit into the %dx%d frame", crop, bounds.Dx(), bounds.Dy()))
+		}
+		bounds = crop.Add(bounds.Min)
+	}
+	if width == 0 && height == 0 {
+		width, height = bounds.Dx(), bounds.Dy()
+	} else if width == 0 {
+		width = bounds.Dx() * height / bounds.Dy()
+	} else if height == 0 {
+		height = bounds.Dy() * width / bounds.Dx()
+	}
+	if width == 0 || height == 0 {
+		return nil, errors.New(fmt.Sprintf("resizing %dx%d to %dx%d leaves nothing", bounds.Dx(), bounds.Dy(), width, height))
+	}
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+	if width == bounds.Dx() && height == bounds.Dy() {
+		draw.Draw(result, result.Bounds(), img, bounds.Min, draw.Src)
+	} else {
+		draw.CatmullRom.Scale(result, result.Bounds(), img, bounds, draw.Src, nil)
+	}
+	return result, nil
+}
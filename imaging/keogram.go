@@ -0,0 +1,33 @@
+package imaging
+
+import (
+	"errors"
+	"image"
+	"log"
+)
+
+// Keogram puts the central pixel column of every frame side by side, so the
+// resulting image is len(frames) pixels wide and as tall as the first frame.
+func Keogram(frames []string) (*image.RGBA, error) {
+	var keogram *image.RGBA
+	for i, frame := range frames {
+		img, err := LoadImage(frame)
+		if err != nil {
+			log.Printf("Skipping %s in keogram: %v", frame, err)
+			continue
+		}
+		bounds := img.Bounds()
+		if keogram == nil {
+			keogram = image.NewRGBA(image.Rect(0, 0, len(frames), bounds.Dy()))
+		}
+		height := keogram.Bounds().Dy()
+		x := bounds.Min.X + bounds.Dx()/2
+		for y := 0; y < height; y++ {
+			keogram.Set(i, y, img.At(x, bounds.Min.Y+y*bounds.Dy()/height))
+		}
+	}
+	if keogram == nil {
+		return nil, errors.New("no decodable frames for keogram")
+	}
+	return keogram, nil
+}
@@ -0,0 +1,20 @@
+package imaging
+
+import (
+	"image"
+)
+
+const luminanceSampleWidth = 320
+
+// MeanLuminance is the average luma of img in the range 0-255.
+func MeanLuminance(img image.Image) float64 {
+	gray := Grayscale(img, luminanceSampleWidth)
+	if len(gray.Pix) == 0 {
+		return 0
+	}
+	var sum uint64
+	for _, value := range gray.Pix {
+		sum += uint64(value)
+	}
+	return float64(sum) / float64(len(gray.Pix))
+}
@@ -0,0 +1,144 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+type MaskStyle string
+
+const (
+	MaskBlack MaskStyle = "black"
+	MaskBlur  MaskStyle = "blur"
+)
+
+// blurDivider is how much the image is shrunk for blurring, big enough that
+// faces and number plates are not recognizable on a 4K frame.
+const blurDivider = 48
+
+// Mask is a polygon, in pixels of the full frame, that must never be stored.
+type Mask struct {
+	Polygon []image.Point
+}
+
+// ParseMasks reads masks separated by ";", each either "rect x,y,width,height"
+// or "polygon x1,y1 x2,y2 x3,y3 ...".
+func ParseMasks(spec string) ([]Mask, error) {
+	var masks []Mask
+	for _, part := range strings.Split(spec, ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "rect":
+			if len(fields) != 2 {
+				return nil, errors.New(fmt.Sprintf("rect mask %q must be x,y,width,height", part))
+			}
+			numbers, err := parseInts(fields[1], 4)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("rect mask %q: %v", part, err))
+			}
+			x, y, w, h := numbers[0], numbers[1], numbers[2], numbers[3]
+			masks = append(masks, Mask{Polygon: []image.Point{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}})
+		case "polygon":
+			if len(fields) < 4 {
+				return nil, errors.New(fmt.Sprintf("polygon mask %q needs at least 3 points", part))
+			}
+			var polygon []image.Point
+			for _, field := range fields[1:] {
+				numbers, err := parseInts(field, 2)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("polygon mask %q: %v", part, err))
+				}
+				polygon = append(polygon, image.Pt(numbers[0], numbers[1]))
+			}
+			masks = append(masks, Mask{Polygon: polygon})
+		default:
+			return nil, errors.New(fmt.Sprintf("unknown mask kind %q", fields[0]))
+		}
+	}
+	return masks, nil
+}
+
+func parseInts(value string, count int) ([]int, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != count {
+		return nil, errors.New(fmt.Sprintf("expected %d comma separated numbers in %q", count, value))
+	}
+	numbers := make([]int, count)
+	for i, part := range parts {
+		number, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
+
+func (m Mask) bounds() image.Rectangle {
+	r := image.Rectangle{Min: m.Polygon[0], Max: m.Polygon[0]}
+	for _, p := range m.Polygon[1:] {
+		r = r.Union(image.Rectangle{Min: p, Max: p.Add(image.Pt(1, 1))})
+	}
+	return r
+}
+
+// contains is the even-odd rule, evaluated at the pixel centre.
+func (m Mask) contains(x int, y int) bool {
+	px, py := float64(x)+0.5, float64(y)+0.5
+	inside := false
+	for i, j := 0, len(m.Polygon)-1; i < len(m.Polygon); j, i = i, i+1 {
+		a, b := m.Polygon[i], m.Polygon[j]
+		ay, by := float64(a.Y), float64(b.Y)
+		if (ay > py) != (by > py) {
+			crossX := float64(a.X) + (py-ay)*float64(b.X-a.X)/(by-ay)
+			if px < crossX {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// ApplyMasks returns a copy of img with the masked areas blacked out or blurred.
+func ApplyMasks(img image.Image, masks []Mask, style MaskStyle) *image.RGBA {
+	bounds := img.Bounds()
+	masked := image.NewRGBA(bounds)
+	draw.Draw(masked, bounds, img, bounds.Min, draw.Src)
+
+	var fill image.Image = image.NewUniform(color.Black)
+	if style == MaskBlur {
+		small := image.NewRGBA(image.Rect(0, 0, max(bounds.Dx()/blurDivider, 1), max(bounds.Dy()/blurDivider, 1)))
+		draw.ApproxBiLinear.Scale(small, small.Bounds(), img, bounds, draw.Src, nil)
+		blurred := image.NewRGBA(bounds)
+		draw.ApproxBiLinear.Scale(blurred, bounds, small, small.Bounds(), draw.Src, nil)
+		fill = blurred
+	}
+
+	for _, mask := range masks {
+		area := mask.bounds().Intersect(bounds)
+		for y := area.Min.Y; y < area.Max.Y; y++ {
+			for x := area.Min.X; x < area.Max.X; x++ {
+				if mask.contains(x, y) {
+					masked.Set(x, y, fill.At(x, y))
+				}
+			}
+		}
+	}
+	return masked
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,44 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"log"
+
+	"golang.org/x/image/draw"
+)
+
+var placeholderColour = color.RGBA{R: 0x20, G: 0x20, B: 0x20, A: 0xff}
+
+// Mosaic composes one frame per camera into a grid of columns, each tile
+// letterboxed into tileWidth x tileHeight and labelled in its corner. An empty path, or one
+// that cannot be decoded, gets a placeholder tile.
+func Mosaic(frames []string, labels []string, columns int, tileWidth int, tileHeight int) *image.RGBA {
+	rows := (len(frames) + columns - 1) / columns
+	mosaic := image.NewRGBA(image.Rect(0, 0, columns*tileWidth, rows*tileHeight))
+	draw.Draw(mosaic, mosaic.Bounds(), image.Black, image.Point{}, draw.Src)
+
+	for i, frame := range frames {
+		x := (i % columns) * tileWidth
+		y := (i / columns) * tileHeight
+		tile := image.Rect(x, y, x+tileWidth, y+tileHeight)
+
+		var img image.Image
+		if frame != "" {
+			var err error
+			if img, err = LoadImage(frame); err != nil {
+				log.Printf("Using placeholder for %s in mosaic: %v", frame, err)
+				img = nil
+			}
+		}
+		label := labels[i]
+		if img == nil {
+			draw.Draw(mosaic, tile, image.NewUniform(placeholderColour), image.Point{}, draw.Src)
+			label += " (no frame)"
+		} else {
+			draw.Draw(mosaic, tile, Letterbox(img, tileWidth, tileHeight), image.Point{}, draw.Src)
+		}
+		DrawLabel(mosaic, label, image.Pt(x+8, y+18), color.White)
+	}
+	return mosaic
+}
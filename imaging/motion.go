@@ -0,0 +1,58 @@
+package imaging
+
+import (
+	"image"
+	"log"
+
+	"golang.org/x/image/draw"
+)
+
+// Grayscale scales img down to width pixels (keeping the aspect ratio) and
+// returns its luma, which is enough for comparing frames cheaply.
+func Grayscale(img image.Image, width int) *image.Gray {
+	bounds := img.Bounds()
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	gray := image.NewGray(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(gray, gray.Bounds(), img, bounds, draw.Src, nil)
+	return gray
+}
+
+// MeanAbsoluteDifference compares two grayscale images of the same size and
+// returns the average per-pixel difference in the range 0-255.
+func MeanAbsoluteDifference(a *image.Gray, b *image.Gray) float64 {
+	if a.Bounds() != b.Bounds() || len(a.Pix) == 0 {
+		return 0
+	}
+	var sum uint64
+	for i := range a.Pix {
+		if a.Pix[i] > b.Pix[i] {
+			sum += uint64(a.Pix[i] - b.Pix[i])
+		} else {
+			sum += uint64(b.Pix[i] - a.Pix[i])
+		}
+	}
+	return float64(sum) / float64(len(a.Pix))
+}
+
+// FrameDifferences returns, for every frame, its difference from the previous
+// decodable frame. The first frame and undecodable frames get 0.
+func FrameDifferences(frames []string, sampleWidth int) []float64 {
+	differences := make([]float64, len(frames))
+	var previous *image.Gray
+	for i, frame := range frames {
+		img, err := LoadImage(frame)
+		if err != nil {
+			log.Printf("Skipping %s in motion analysis: %v", frame, err)
+			continue
+		}
+		current := Grayscale(img, sampleWidth)
+		if previous != nil {
+			differences[i] = MeanAbsoluteDifference(previous, current)
+		}
+		previous = current
+	}
+	return differences
+}
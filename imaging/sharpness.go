@@ -0,0 +1,29 @@
+package imaging
+
+import (
+	"image"
+)
+
+// Sharpness returns the variance of the Laplacian of img scaled down to
+// sampleWidth. Blurry frames (autofocus hunting, rain on the lens) have few
+// edges and so a low variance.
+func Sharpness(img image.Image, sampleWidth int) float64 {
+	gray := Grayscale(img, sampleWidth)
+	width, height := gray.Rect.Dx(), gray.Rect.Dy()
+	if width < 3 || height < 3 {
+		return 0
+	}
+	var sum, sumSquares float64
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			i := y*gray.Stride + x
+			laplacian := float64(gray.Pix[i-gray.Stride]) + float64(gray.Pix[i+gray.Stride]) +
+				float64(gray.Pix[i-1]) + float64(gray.Pix[i+1]) - 4*float64(gray.Pix[i])
+			sum += laplacian
+			sumSquares += laplacian * laplacian
+		}
+	}
+	n := float64((width - 2) * (height - 2))
+	mean := sum / n
+	return sumSquares/n - mean*mean
+}
@@ -0,0 +1,61 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font/basicfont"
+)
+
+// TitleCard draws the lines centred on a black width x height card. The bitmap
+// font is rendered at its native size and scaled up so that the text block
+// fills about a third of the card height.
+func TitleCard(width int, height int, lines []string) *image.RGBA {
+	card := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(card, card.Bounds(), image.Black, image.Point{}, draw.Src)
+
+	face := basicfont.Face7x13
+	lineHeight := face.Height + 4
+	textWidth := 0
+	for _, line := range lines {
+		if w := len(line) * face.Advance; w > textWidth {
+			textWidth = w
+		}
+	}
+	if textWidth == 0 {
+		return card
+	}
+	text := image.NewRGBA(image.Rect(0, 0, textWidth, lineHeight*len(lines)))
+	for i, line := range lines {
+		x := (textWidth - len(line)*face.Advance) / 2
+		DrawLabel(text, line, image.Pt(x, i*lineHeight+face.Ascent), color.White)
+	}
+
+	scale := height / 3 / text.Bounds().Dy()
+	if maxScale := width * 9 / 10 / textWidth; maxScale < scale {
+		scale = maxScale
+	}
+	if scale < 1 {
+		scale = 1
+	}
+	scaledWidth, scaledHeight := textWidth*scale, text.Bounds().Dy()*scale
+	target := image.Rect((width-scaledWidth)/2, (height-scaledHeight)/2, (width+scaledWidth)/2, (height+scaledHeight)/2)
+	draw.NearestNeighbor.Scale(card, target, text, text.Bounds(), draw.Over, nil)
+	return card
+}
+
+// Letterbox fits img into a black width x height frame keeping its aspect ratio.
+func Letterbox(img image.Image, width int, height int) *image.RGBA {
+	frame := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(frame, frame.Bounds(), image.Black, image.Point{}, draw.Src)
+
+	bounds := img.Bounds()
+	scaledWidth, scaledHeight := width, bounds.Dy()*width/bounds.Dx()
+	if scaledHeight > height {
+		scaledWidth, scaledHeight = bounds.Dx()*height/bounds.Dy(), height
+	}
+	target := image.Rect((width-scaledWidth)/2, (height-scaledHeight)/2, (width+scaledWidth)/2, (height+scaledHeight)/2)
+	draw.ApproxBiLinear.Scale(frame, target, img, bounds, draw.Src, nil)
+	return frame
+}
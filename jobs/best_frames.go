@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"log"
+	"time"
+	"timelapse_maker/imaging"
+)
+
+const sharpnessSampleWidth = 640
+
+type BestFrameSettings struct {
+	Bucket time.Duration //frames captured within the same bucket compete, only the sharpest is kept
+}
+
+// selectBestFrames keeps the sharpest frame of every bucket. Frames without a
+// parsable capture time are kept as they are, undecodable ones are dropped
+// unless they are all the bucket has.
+func selectBestFrames(frames []string, settings BestFrameSettings) []string {
+	if settings.Bucket <= 0 {
+		return frames
+	}
+	selected := make([]string, 0, len(frames))
+	var bucket []string
+	var bucketStart time.Time
+	flush := func() {
+		if len(bucket) > 0 {
+			selected = append(selected, sharpestFrame(bucket))
+			bucket = nil
+		}
+	}
+	for _, frame := range frames {
+		captured, err := frameCaptureTime(frame)
+		if err != nil {
+			flush()
+			selected = append(selected, frame)
+			continue
+		}
+		start := captured.Truncate(settings.Bucket)
+		if !start.Equal(bucketStart) {
+			flush()
+			bucketStart = start
+		}
+		bucket = append(bucket, frame)
+	}
+	flush()
+	log.Printf("Selected %d sharpest of %d frames in %s buckets", len(selected), len(frames), settings.Bucket)
+	return selected
+}
+
+func sharpestFrame(frames []string) string {
+	best := frames[0]
+	bestSharpness := -1.0
+	for _, frame := range frames {
+		img, err := imaging.LoadImage(frame)
+		if err != nil {
+			log.Printf("Skipping %s in sharpness selection: %v", frame, err)
+			continue
+		}
+		if sharpness := imaging.Sharpness(img, sharpnessSampleWidth); sharpness > bestSharpness {
+			best, bestSharpness = frame, sharpness
+		}
+	}
+	return best
+}
@@ -0,0 +1,7 @@
+package jobs
+
+type Camera struct {
+	Name                string
+	ImagesRootDirectory string //holds the <TimelapseType.Directory>/<period> image trees
+	MosaicOnly          bool   //images are only kept for mosaics and removed once one is rendered
+}
@@ -0,0 +1,151 @@
+package jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"timelapse_maker/imaging"
+)
+
+const (
+	movementSampleWidth  = 128
+	movementMaxShift     = 12
+	movementRotationStep = 0.5
+
+	referenceFrameName = "reference.jpg"
+)
+
+var (
+	cameraShift         = expvar.NewMap("camera_shift_pixels")
+	cameraRotation      = expvar.NewMap("camera_rotation_degrees")
+	cameraMovedAlerts   = expvar.NewMap("camera_moved_alerts")
+	movementAlertClient = &http.Client{Timeout: time.Second * 10}
+)
+
+// CameraMovementDetector compares every captured frame with a reference frame
+// of the camera and raises an alert once the view has shifted or rotated past
+// the thresholds. The reference is the first frame seen after it was reset.
+type CameraMovementDetector struct {
+	CameraName        string
+	ReferenceFile     string
+	ShiftThreshold    float64 //pixels of the full frame
+	RotationThreshold float64 //degrees, also the largest rotation searched for
+	WebhookUrl        string
+
+	mutex   sync.Mutex
+	alerted bool
+}
+
+type cameraMovedAlert struct {
+	Camera   string    `json:"camera"`
+	Frame    string    `json:"frame"`
+	ShiftX   float64   `json:"shift_x"`
+	ShiftY   float64   `json:"shift_y"`
+	Rotation float64   `json:"rotation"`
+	Score    float64   `json:"score"`
+	At       time.Time `json:"at"`
+}
+
+func ReferenceFramePath(imagesRootDirectory string) string {
+	return filepath.Join(imagesRootDirectory, referenceFrameName)
+}
+
+// ResetReference drops the reference frame; the next captured frame replaces it.
+func ResetReference(imagesRootDirectory string) error {
+	err := os.Remove(ReferenceFramePath(imagesRootDirectory))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Check compares the frame saved at framePath, encoded as content, with the reference.
+func (d *CameraMovementDetector) Check(framePath string, content []byte) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	current, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		log.Printf("Unable to decode %s for movement check: %v", framePath, err)
+		return
+	}
+	reference, err := imaging.LoadImage(d.ReferenceFile)
+	if os.IsNotExist(err) {
+		if err = os.WriteFile(d.ReferenceFile, content, 0660); err != nil {
+			log.Printf("Unable to save reference frame of camera %s: %v", d.CameraName, err)
+			return
+		}
+		d.alerted = false
+		log.Printf("Saved %s as reference frame of camera %s", framePath, d.CameraName)
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to load reference frame of camera %s: %v", d.CameraName, err)
+		return
+	}
+	if reference.Bounds().Size() != current.Bounds().Size() {
+		log.Printf("Frame %s is %v while the reference of camera %s is %v, reset the reference",
+			framePath, current.Bounds().Size(), d.CameraName, reference.Bounds().Size())
+		return
+	}
+
+	alignment := imaging.EstimateAlignment(reference, current, movementSampleWidth, movementMaxShift,
+		d.RotationThreshold*2, movementRotationStep)
+	cameraShift.Set(d.CameraName, floatVar(alignment.Shift()))
+	cameraRotation.Set(d.CameraName, floatVar(alignment.Rotation))
+
+	moved := alignment.Shift() > d.ShiftThreshold ||
+		alignment.Rotation > d.RotationThreshold || -alignment.Rotation > d.RotationThreshold
+	if !moved {
+		if d.alerted {
+			log.Printf("Camera %s is back in place (shift %.1fpx, rotation %.1f°)", d.CameraName, alignment.Shift(), alignment.Rotation)
+		}
+		d.alerted = false
+		return
+	}
+	if d.alerted {
+		return
+	}
+	d.alerted = true
+	cameraMovedAlerts.Add(d.CameraName, 1)
+	log.Printf("ALERT: camera %s moved, %s is shifted by %.1fx%.1fpx and rotated by %.1f° from the reference",
+		d.CameraName, framePath, alignment.ShiftX, alignment.ShiftY, alignment.Rotation)
+	if d.WebhookUrl != "" {
+		alert := cameraMovedAlert{Camera: d.CameraName, Frame: framePath, ShiftX: alignment.ShiftX, ShiftY: alignment.ShiftY,
+			Rotation: alignment.Rotation, Score: alignment.Score, At: time.Now()}
+		if err = postMovementAlert(d.WebhookUrl, alert); err != nil {
+			log.Printf("Unable to post camera movement alert: %v", err)
+		}
+	}
+}
+
+func postMovementAlert(url string, alert cameraMovedAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	response, err := movementAlertClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return errors.New(fmt.Sprintf("webhook answered with status %d", response.StatusCode))
+	}
+	return nil
+}
+
+func floatVar(value float64) *expvar.Float {
+	v := new(expvar.Float)
+	v.Set(value)
+	return v
+}
@@ -0,0 +1,189 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ChunkedEncoder splits long frame lists into Chunks parts, encodes up to
+// Workers of them at once with closed GOPs and joins the parts with the concat
+// demuxer using stream copy, so the result plays like a single-pass encode.
+type ChunkedEncoder struct {
+	Encoder        Encoder //single-pass encodes
+	ChunkEncoder   Encoder //encodes of one chunk, Encoder when nil
+	Chunks         int
+	Workers        int
+	MinChunkFrames int //lists shorter than Chunks*MinChunkFrames are encoded in one pass
+	Limits         FfmpegLimits
+}
+
+// NewChunkedEncoder encodes with ffmpeg, splitting limits.Threads across the
+// workers so that the chunks encoded at once stay within the thread limit of
+// a single-pass encode. There are never more workers than threads then.
+func NewChunkedEncoder(limits FfmpegLimits, chunks int, workers int, minChunkFrames int) (ChunkedEncoder, error) {
+	if workers < 1 {
+		return ChunkedEncoder{}, errors.New(fmt.Sprintf("chunked encoding needs at least one worker, got %d", workers))
+	}
+	chunkLimits := limits
+	if limits.Threads > 0 {
+		if workers > limits.Threads {
+			workers = limits.Threads
+		}
+		chunkLimits.Threads = limits.Threads / workers
+	}
+	return ChunkedEncoder{
+		Encoder:        FfmpegEncoder{Limits: limits},
+		ChunkEncoder:   FfmpegEncoder{Limits: chunkLimits},
+		Chunks:         chunks,
+		Workers:        workers,
+		MinChunkFrames: minChunkFrames,
+		Limits:         limits,
+	}, nil
+}
+
+func (e ChunkedEncoder) Encode(ctx context.Context, request EncodeRequest, progress func(p FFMpegProgress)) error {
+	chunks := splitFrames(request.Frames, e.Chunks)
+	// fades and the audio track span the whole video, so they need a single pass
+	singlePass := request.Profile.Audio != nil || request.Profile.VideoFadeSeconds > 0
+	if singlePass || len(chunks) < 2 || len(request.Frames) < e.Chunks*e.MinChunkFrames {
+		return e.Encoder.Encode(ctx, request, progress)
+	}
+	if e.Workers < 1 {
+		return errors.New(fmt.Sprintf("chunked encoding needs at least one worker, got %d", e.Workers))
+	}
+	chunkEncoder := e.ChunkEncoder
+	if chunkEncoder == nil {
+		chunkEncoder = e.Encoder
+	}
+
+	directory, err := os.MkdirTemp(filepath.Dir(request.OutputPath), ".chunks-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(directory)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	aggregate := newChunkProgress(len(chunks), uint64(len(request.Frames)), progress)
+	chunkPaths := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	workers := make(chan struct{}, e.Workers)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		chunkPaths[i] = filepath.Join(directory, fmt.Sprintf("chunk_%03d.mp4", i))
+		wg.Add(1)
+		go func(i int, chunk []string) {
+			defer wg.Done()
+			select {
+			case workers <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			defer func() { <-workers }()
+
+			log.Printf("Encoding chunk %d/%d of %d frames", i+1, len(chunks), len(chunk))
+			chunkRequest := EncodeRequest{Frames: chunk, OutputPath: chunkPaths[i], Profile: request.Profile, ClosedGop: true}
+			errs[i] = chunkEncoder.Encode(ctx, chunkRequest, func(p FFMpegProgress) {
+				aggregate.update(i, p)
+			})
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i, chunk)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return errors.New(fmt.Sprintf("encoding chunk %d: %v", i+1, err))
+		}
+	}
+
+	return e.join(ctx, chunkPaths, request.OutputPath)
+}
+
+func (e ChunkedEncoder) Probe(path string) (VideoMetadata, error) {
+	return e.Encoder.Probe(path)
+}
+
+func (e ChunkedEncoder) join(ctx context.Context, chunkPaths []string, outputPath string) error {
+	list, err := os.CreateTemp("", "*.txt")
+	if err != nil {
+		return err
+	}
+	defer removeTemporaryFile(list.Name())
+	for _, chunkPath := range chunkPaths {
+		_, _ = list.WriteString(fmt.Sprintf("file '%s'\n", chunkPath))
+	}
+	if err = list.Close(); err != nil {
+		return err
+	}
+
+	log.Printf("Joining %d chunks into %s", len(chunkPaths), outputPath)
+	stream := ffmpeg.Input(list.Name(), ffmpeg.KwArgs{"safe": 0, "f": "concat"}).
+		Output(outputPath, ffmpeg.KwArgs{"c": "copy"}).
+		OverWriteOutput()
+	return runFfmpeg(ctx, stream, e.Limits)
+}
+
+func splitFrames(frames []string, chunks int) [][]string {
+	if chunks <= 1 || len(frames) < chunks {
+		return [][]string{frames}
+	}
+	result := make([][]string, 0, chunks)
+	for i := 0; i < chunks; i++ {
+		result = append(result, frames[i*len(frames)/chunks:(i+1)*len(frames)/chunks])
+	}
+	return result
+}
+
+// chunkProgress folds the progress of parallel chunk encodes into one stream
+// of FFMpegProgress for the whole frame list.
+type chunkProgress struct {
+	mutex       sync.Mutex
+	frames      []uint64
+	ended       []bool
+	totalFrames uint64
+	started     time.Time
+	listener    func(p FFMpegProgress)
+}
+
+func newChunkProgress(chunks int, totalFrames uint64, listener func(p FFMpegProgress)) *chunkProgress {
+	return &chunkProgress{
+		frames:      make([]uint64, chunks),
+		ended:       make([]bool, chunks),
+		totalFrames: totalFrames,
+		started:     time.Now(),
+		listener:    listener,
+	}
+}
+
+func (c *chunkProgress) update(chunk int, p FFMpegProgress) {
+	if c.listener == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.frames[chunk] = p.Frame
+	c.ended[chunk] = p.Status == End
+
+	combined := p
+	combined.Frame = 0
+	combined.Status = End
+	for i, frames := range c.frames {
+		combined.Frame += frames
+		if !c.ended[i] {
+			combined.Status = Continue
+		}
+	}
+	combined.derive(c.totalFrames, time.Since(c.started))
+	c.listener(combined)
+}
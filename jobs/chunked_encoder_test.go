@@ -0,0 +1,34 @@
+package jobs
+
+import "testing"
+
+func TestNewChunkedEncoderSplitsThreadsAcrossWorkers(t *testing.T) {
+	for _, c := range []struct {
+		threads, workers              int
+		expectedWorkers, chunkThreads int
+	}{
+		{threads: 2, workers: 2, expectedWorkers: 2, chunkThreads: 1},
+		{threads: 8, workers: 3, expectedWorkers: 3, chunkThreads: 2},
+		{threads: 2, workers: 4, expectedWorkers: 2, chunkThreads: 1},
+		{threads: 0, workers: 2, expectedWorkers: 2, chunkThreads: 0},
+	} {
+		encoder, err := NewChunkedEncoder(FfmpegLimits{Threads: c.threads}, 4, c.workers, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunkThreads := encoder.ChunkEncoder.(FfmpegEncoder).Limits.Threads
+		if encoder.Workers != c.expectedWorkers || chunkThreads != c.chunkThreads {
+			t.Errorf("%d threads for %d workers: %d workers of %d threads, expected %d of %d",
+				c.threads, c.workers, encoder.Workers, chunkThreads, c.expectedWorkers, c.chunkThreads)
+		}
+		if single := encoder.Encoder.(FfmpegEncoder).Limits.Threads; single != c.threads {
+			t.Errorf("single-pass encodes got %d threads, expected %d", single, c.threads)
+		}
+	}
+}
+
+func TestNewChunkedEncoderRejectsZeroWorkers(t *testing.T) {
+	if _, err := NewChunkedEncoder(FfmpegLimits{Threads: 2}, 4, 0, 100); err == nil {
+		t.Error("zero workers were accepted")
+	}
+}
@@ -0,0 +1,152 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"log"
+	"os"
+	"sort"
+	"time"
+	"timelapse_maker/constants"
+	"timelapse_maker/cron"
+)
+
+type CoverageSettings struct {
+	Schedule   cron.Schedule  //the download schedule of the type
+	Location   *time.Location //the location the scheduler runs in
+	Tolerance  time.Duration  //a frame this close to a slot fills it
+	MaxGaps    int            //longest gaps kept in the report
+	MinPercent float64        //renders below this coverage are blocked until forced, 0 to never block
+}
+
+// CoverageTooLowError blocks a render: its period is over, so retrying cannot
+// make the coverage any better.
+type CoverageTooLowError struct {
+	Percent    float64
+	MinPercent float64
+}
+
+func (e CoverageTooLowError) Error() string {
+	return fmt.Sprintf("coverage %.1f%% is below the required %.1f%%", e.Percent, e.MinPercent)
+}
+
+// CoverageGap is a run of consecutive missing slots.
+type CoverageGap struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Missing int       `json:"missing"`
+}
+
+type CoverageReport struct {
+	Expected int
+	Present  int
+	Percent  float64
+	Missing  []time.Time
+	Gaps     []CoverageGap //longest first
+}
+
+func (r CoverageReport) String() string {
+	longest := "none"
+	if len(r.Gaps) > 0 {
+		gap := r.Gaps[0]
+		longest = fmt.Sprintf("%s - %s (%d slots)", gap.From.Format(time.RFC3339), gap.To.Format(time.RFC3339), gap.Missing)
+	}
+	return fmt.Sprintf("%d of %d slots captured (%.1f%%), longest gap: %s", r.Present, r.Expected, r.Percent, longest)
+}
+
+// expectedSlots iterates the schedule over [start, end).
+func (s CoverageSettings) expectedSlots(start time.Time, end time.Time) []time.Time {
+	var slots []time.Time
+	for t := s.Schedule.Next(start.In(s.Location).Add(-time.Second)); !t.IsZero() && t.Before(end); t = s.Schedule.Next(t) {
+		slots = append(slots, t)
+	}
+	return slots
+}
+
+// Report compares the slots the download schedule fired at during the period
+// with the frames that are present. Each frame fills at most one slot.
+func (s CoverageSettings) Report(timelapseType *constants.TimelapseType, period string, frames []string) (CoverageReport, error) {
+	start, end, err := timelapseType.PeriodBounds(period)
+	if err != nil {
+		return CoverageReport{}, errors.New(fmt.Sprintf("bounds of period %s: %v", period, err))
+	}
+	var captured []time.Time
+	for _, frame := range frames {
+		if t, err := frameCaptureTime(frame); err == nil {
+			captured = append(captured, t)
+		}
+	}
+	sort.Slice(captured, func(i, j int) bool { return captured[i].Before(captured[j]) })
+
+	slots := s.expectedSlots(start, end)
+	report := CoverageReport{Expected: len(slots), Percent: 100, Missing: []time.Time{}, Gaps: []CoverageGap{}}
+	gap := -1
+	next := 0
+	for _, slot := range slots {
+		for next < len(captured) && captured[next].Before(slot.Add(-s.Tolerance)) {
+			next++
+		}
+		if next < len(captured) && !captured[next].After(slot.Add(s.Tolerance)) {
+			next++
+			report.Present++
+			gap = -1
+			continue
+		}
+		report.Missing = append(report.Missing, slot)
+		if gap < 0 {
+			report.Gaps = append(report.Gaps, CoverageGap{From: slot})
+			gap = len(report.Gaps) - 1
+		}
+		report.Gaps[gap].To = slot
+		report.Gaps[gap].Missing++
+	}
+	if report.Expected > 0 {
+		report.Percent = float64(report.Present) * 100 / float64(report.Expected)
+	}
+	sort.SliceStable(report.Gaps, func(i, j int) bool { return report.Gaps[i].Missing > report.Gaps[j].Missing })
+	if s.MaxGaps > 0 && len(report.Gaps) > s.MaxGaps {
+		report.Gaps = report.Gaps[:s.MaxGaps]
+	}
+	return report, nil
+}
+
+// CoverageReport reports on the images of the period as they are now.
+func (g VideoMakerJob) CoverageReport(period string) (CoverageReport, error) {
+	if g.Coverage == nil {
+		return CoverageReport{}, errors.New(fmt.Sprintf("coverage of %s is not configured", g.TimelapseType.Name))
+	}
+	frames, err := listFrames(g.imagesDirectory(period))
+	if err != nil && !os.IsNotExist(err) {
+		return CoverageReport{}, err
+	}
+	return g.Coverage.Report(g.TimelapseType, period, frames)
+}
+
+// checkCoverage logs the coverage of the period and returns a
+// CoverageTooLowError when it is below the configured minimum.
+func (g VideoMakerJob) checkCoverage(period string, frames []string) error {
+	report, err := g.Coverage.Report(g.TimelapseType, period, frames)
+	if err != nil {
+		return err
+	}
+	log.Printf("Coverage of %s %s: %s", g.TimelapseType.Name, period, report)
+	if g.Coverage.MinPercent > 0 && report.Percent < g.Coverage.MinPercent {
+		return CoverageTooLowError{Percent: report.Percent, MinPercent: g.Coverage.MinPercent}
+	}
+	return nil
+}
+
+func saveCoverageTx(tx pgx.Tx, videoID uint64, report CoverageReport) error {
+	gaps, err := json.Marshal(report.Gaps)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(context.Background(),
+		"INSERT INTO \"lig2\".coverage_reports (video_id, expected_slots, present_slots, coverage_percent, missing_slots, longest_gaps) "+
+			"VALUES ($1, $2, $3, $4, $5, $6)",
+		videoID, report.Expected, report.Present, report.Percent, report.Missing, string(gaps))
+	return err
+}
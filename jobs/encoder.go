@@ -0,0 +1,20 @@
+package jobs
+
+import (
+	"context"
+	"timelapse_maker/constants"
+)
+
+type EncodeRequest struct {
+	Frames     []string //ordered absolute frame paths
+	OutputPath string
+	Profile    *constants.EncodingProfile
+	ClosedGop  bool //start and end on GOP boundaries so outputs can be joined by stream copy
+}
+
+// Encoder turns an ordered frame list into a video file. Cancelling ctx must
+// stop the encode; a partially written OutputPath is left to the caller.
+type Encoder interface {
+	Encode(ctx context.Context, request EncodeRequest, progress func(p FFMpegProgress)) error
+	Probe(path string) (VideoMetadata, error)
+}
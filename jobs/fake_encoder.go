@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const fakeVideoFormat = "fake video of %d frames at %d fps, %s %dx%d\n"
+
+// FakeEncoder is an in-process Encoder for tests and dry runs. It writes a
+// stub file describing the request, reports one synthetic progress block per
+// frame and answers Probe from the stub file, like a real probe would.
+type FakeEncoder struct {
+	FrameDelay time.Duration //wall time spent per frame, lets tests cancel mid-encode
+	Err        error         //returned from Encode instead of writing the file
+}
+
+func (e *FakeEncoder) Encode(ctx context.Context, request EncodeRequest, progress func(p FFMpegProgress)) error {
+	started := time.Now()
+	total := uint64(len(request.Frames))
+	for frame := uint64(1); frame <= total; frame++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(e.FrameDelay):
+		}
+		if progress != nil {
+			p := FFMpegProgress{
+				Frame:     frame,
+				Fps:       "0.0",
+				OutTimeUs: frame * uint64(time.Second/time.Microsecond) / uint64(request.Profile.Framerate),
+				Status:    Continue,
+			}
+			if frame == total {
+				p.Status = End
+			}
+			p.derive(total, time.Since(started))
+			progress(p)
+		}
+	}
+	if e.Err != nil {
+		return e.Err
+	}
+	profile := request.Profile
+	content := fmt.Sprintf(fakeVideoFormat, total, profile.Framerate, profile.CodecName, profile.Width, profile.Height)
+	return os.WriteFile(request.OutputPath, []byte(content), 0660)
+}
+
+func (e *FakeEncoder) Probe(path string) (VideoMetadata, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return VideoMetadata{}, err
+	}
+	var metadata VideoMetadata
+	var framerate int
+	_, err = fmt.Sscanf(string(content), fakeVideoFormat,
+		&metadata.FrameCount, &framerate, &metadata.Codec, &metadata.Width, &metadata.Height)
+	if err != nil || framerate <= 0 {
+		return VideoMetadata{}, errors.New(fmt.Sprintf("%s is not a fake video: %v", path, err))
+	}
+	metadata.DurationSeconds = float64(metadata.FrameCount) / float64(framerate)
+	return metadata, nil
+}
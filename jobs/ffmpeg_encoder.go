@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+	"timelapse_maker/constants"
+)
+
+// FfmpegEncoder is the production Encoder running ffmpeg over a concat list.
+type FfmpegEncoder struct {
+	Limits FfmpegLimits
+}
+
+func (e FfmpegEncoder) Encode(ctx context.Context, request EncodeRequest, progress func(p FFMpegProgress)) error {
+	profile := request.Profile
+	listener, socketError := listenFfmpegProgress(uint64(len(request.Frames)), progress)
+	if socketError != nil {
+		log.Printf("Error while opening socket for listening ffmpeg progress: %v", socketError)
+	} else {
+		defer listener.close()
+		log.Printf("Preparing to listen ffmpeg progress on %s", listener.url())
+	}
+
+	file, err := createFrameOrderFile(request.Frames, profile.Framerate)
+	if err != nil {
+		return err
+	}
+	defer removeTemporaryFile(file)
+	log.Printf("Prepared Frame order in file %s", file)
+
+	inputArgs := ffmpeg.KwArgs{"r": fmt.Sprintf("%d/1", profile.Framerate), "safe": 0, "f": "concat"}
+	if socketError == nil {
+		inputArgs["progress"] = listener.url()
+	}
+	outputArgs := ffmpeg.KwArgs{"crf": profile.Crf, "s": fmt.Sprintf("%dx%d", profile.Width, profile.Height), "vcodec": profile.Encoder}
+	if request.ClosedGop {
+		e.Limits.apply(outputArgs, profile.Encoder, "open-gop=0")
+	} else {
+		e.Limits.apply(outputArgs, profile.Encoder)
+	}
+
+	video := ffmpeg.Input(file, inputArgs)
+	length := float64(len(request.Frames)) / float64(profile.Framerate)
+	if fade := profile.VideoFadeSeconds; fade > 0 {
+		video = video.
+			Filter("fade", nil, ffmpeg.KwArgs{"t": "in", "st": 0, "d": formatSeconds(fade)}).
+			Filter("fade", nil, ffmpeg.KwArgs{"t": "out", "st": formatSeconds(length - fade), "d": formatSeconds(fade)})
+	}
+	if profile.Audio == nil {
+		return runFfmpeg(ctx, video.Output(request.OutputPath, outputArgs).OverWriteOutput(), e.Limits)
+	}
+
+	track, err := pickAudioTrack(profile.Audio, time.Now())
+	if err != nil {
+		return err
+	}
+	log.Printf("Adding audio track %s", track)
+	audio := ffmpeg.Input(track, ffmpeg.KwArgs{"stream_loop": -1}).Audio().
+		Filter("atrim", nil, ffmpeg.KwArgs{"duration": formatSeconds(length)})
+	if fade := profile.Audio.FadeSeconds; fade > 0 {
+		audio = audio.
+			Filter("afade", nil, ffmpeg.KwArgs{"t": "in", "st": 0, "d": formatSeconds(fade)}).
+			Filter("afade", nil, ffmpeg.KwArgs{"t": "out", "st": formatSeconds(length - fade), "d": formatSeconds(fade)})
+	}
+	outputArgs["c:a"] = "aac"
+	outputArgs["b:a"] = profile.Audio.Bitrate
+	outputArgs["shortest"] = ""
+	return runFfmpeg(ctx, ffmpeg.Output([]*ffmpeg.Stream{video, audio}, request.OutputPath, outputArgs).OverWriteOutput(), e.Limits)
+}
+
+func pickAudioTrack(settings *constants.AudioSettings, now time.Time) (string, error) {
+	if settings.File != "" {
+		return settings.File, nil
+	}
+	entries, err := os.ReadDir(settings.Directory)
+	if err != nil {
+		return "", err
+	}
+	var tracks []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			tracks = append(tracks, filepath.Join(settings.Directory, entry.Name()))
+		}
+	}
+	if len(tracks) == 0 {
+		return "", errors.New(fmt.Sprintf("no audio tracks in %s", settings.Directory))
+	}
+	sort.Strings(tracks)
+	days := int(now.Unix() / int64(24*time.Hour/time.Second))
+	return tracks[days%len(tracks)], nil
+}
+
+func formatSeconds(seconds float64) string {
+	if seconds < 0 {
+		seconds = 0
+	}
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+func (e FfmpegEncoder) Probe(path string) (VideoMetadata, error) {
+	return probeVideo(path)
+}
+
+func createFrameOrderFile(frames []string, framerate int) (string, error) {
+	temp, err := os.CreateTemp("", "*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer temp.Close()
+
+	writer := bufio.NewWriter(temp)
+	defer writer.Flush()
+	frameDuration := strconv.FormatFloat(1/float64(framerate), 'f', -1, 64)
+	for _, frame := range frames {
+		_, _ = writer.WriteString(fmt.Sprintf("file '%s'\n", frame))
+		_, _ = writer.WriteString(fmt.Sprintf("duration %s\n", frameDuration))
+	}
+
+	return temp.Name(), nil
+}
@@ -0,0 +1,232 @@
+package jobs
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	Mregexp "regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var Continue = &ProgressStatus{"continue"}
+var End = &ProgressStatus{"end"}
+var bitrateRegex = Mregexp.MustCompile(`(\d+(?:\.\d+)?)kbits/s`)
+
+type FFMpegProgress struct {
+	Frame      uint64
+	Fps        string
+	Bitrate    uint64 //bit per second
+	TotalSize  uint64 //bytes
+	OutTimeUs  uint64 //micros passed
+	OutTime    string //out time as HH:MM:SS.micros
+	DupFrames  uint64
+	DropFrames uint64
+	Speed      string
+	Quality    map[string]float64 //stream_<file>_<stream>_q keyed by "<file>_<stream>"
+	Status     *ProgressStatus
+
+	TotalFrames uint64        //frames in the concat list, 0 if unknown
+	Percent     float64       //0-100, 0 if TotalFrames is unknown
+	Elapsed     time.Duration //wall time since the render started
+	ETA         time.Duration //estimated wall time left, 0 if unknown
+}
+
+type ProgressStatus struct {
+	Name string
+}
+
+// progressListener receives ffmpeg's -progress output on a Unix domain socket
+// inside a private temp directory, so no other user can connect first.
+type progressListener struct {
+	directory string
+	listener  net.Listener
+	mutex     sync.Mutex
+	conn      net.Conn
+	done      chan struct{}
+}
+
+func listenFfmpegProgress(totalFrames uint64, onProgress func(p FFMpegProgress)) (*progressListener, error) {
+	directory, err := os.MkdirTemp("", "ffmpeg-progress-*")
+	if err != nil {
+		return nil, err
+	}
+	socketPath := filepath.Join(directory, "progress.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err == nil {
+		err = os.Chmod(socketPath, 0600)
+	}
+	if err != nil {
+		if listener != nil {
+			listener.Close()
+		}
+		os.RemoveAll(directory)
+		return nil, err
+	}
+
+	l := &progressListener{directory: directory, listener: listener, done: make(chan struct{})}
+	go func() {
+		defer close(l.done)
+		handleFfmpegProgress(l, totalFrames, onProgress)
+	}()
+	return l, nil
+}
+
+func (l *progressListener) url() string {
+	return "unix://" + l.listener.Addr().String()
+}
+
+// close stops accepting, drops the ffmpeg connection if it is still open, waits
+// for the reading goroutine and removes the socket directory.
+func (l *progressListener) close() {
+	l.listener.Close()
+	l.mutex.Lock()
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	l.mutex.Unlock()
+	<-l.done
+	if err := os.RemoveAll(l.directory); err != nil {
+		log.Printf("Error while removing %s: %v", l.directory, err)
+	}
+}
+
+func handleFfmpegProgress(l *progressListener, totalFrames uint64, onProgress func(p FFMpegProgress)) {
+	c, err := l.listener.Accept()
+	if err != nil {
+		if !errors.Is(err, net.ErrClosed) {
+			log.Printf("Error while accepting connection using %s : %v", l.listener.Addr().String(), err)
+		}
+		return
+	}
+	l.mutex.Lock()
+	l.conn = c
+	l.mutex.Unlock()
+	defer c.Close()
+
+	log.Printf("Serving ffmpeg progress on %s", l.listener.Addr().String())
+	started := time.Now()
+	buffer := bufio.NewReader(c)
+	var p = FFMpegProgress{}
+	for {
+		netData, err := buffer.ReadString('\n')
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Error while reading ffmpeg progress: %v", err)
+			}
+			return
+		}
+		if p.parseLine(netData) {
+			p.derive(totalFrames, time.Since(started))
+			if onProgress != nil {
+				onProgress(p)
+			}
+			p = FFMpegProgress{}
+		}
+	}
+}
+
+func (p *FFMpegProgress) derive(totalFrames uint64, elapsed time.Duration) {
+	p.TotalFrames = totalFrames
+	p.Elapsed = elapsed
+	if totalFrames == 0 {
+		return
+	}
+	if p.Status == End {
+		p.Percent = 100
+		return
+	}
+	p.Percent = float64(p.Frame) * 100 / float64(totalFrames)
+	if p.Percent > 100 {
+		p.Percent = 100
+	}
+	if p.Frame > 0 && p.Frame < totalFrames {
+		p.ETA = time.Duration(float64(elapsed) * float64(totalFrames-p.Frame) / float64(p.Frame))
+	}
+}
+
+func (p *FFMpegProgress) parseLine(in string) bool {
+	trimmed := strings.TrimSpace(in)
+	if len(trimmed) == 0 {
+		return false
+	}
+
+	splitValues := strings.Split(trimmed, "=")
+	if len(splitValues) != 2 {
+		return false
+	}
+
+	key := splitValues[0]
+	value := splitValues[1]
+	switch key {
+	case "frame":
+		p.Frame, _ = strconv.ParseUint(value, 10, 64)
+		return false
+	case "fps":
+		p.Fps = value
+		return false
+	case "bitrate":
+		if value == "N/A" {
+			p.Bitrate = 0
+		} else {
+			match := bitrateRegex.FindStringSubmatch(value)
+			if len(match) > 1 && len(match[1]) != 0 {
+				float, _ := strconv.ParseFloat(match[1], 64)
+				p.Bitrate = uint64(float * 1000)
+			} else {
+				p.Bitrate = 0
+			}
+		}
+		return false
+	case "total_size":
+		if value == "N/A" {
+			p.TotalSize = 0
+		} else {
+			p.TotalSize, _ = strconv.ParseUint(value, 10, 64)
+		}
+		return false
+	case "out_time_us", "out_time_ms":
+		// out_time_ms is microseconds too, kept by ffmpeg for compatibility
+		if value[0] == '-' || value == "N/A" {
+			p.OutTimeUs = 0
+		} else {
+			p.OutTimeUs, _ = strconv.ParseUint(value, 10, 64)
+		}
+		return false
+	case "out_time":
+		p.OutTime = value
+		return false
+	case "dup_frames":
+		p.DupFrames, _ = strconv.ParseUint(value, 10, 64)
+		return false
+	case "drop_frames":
+		p.DropFrames, _ = strconv.ParseUint(value, 10, 64)
+		return false
+	case "speed":
+		p.Speed = value
+		return false
+	case "progress":
+		if value == "continue" {
+			p.Status = Continue
+		} else if value == "end" {
+			p.Status = End
+		}
+		return true
+	default:
+		if strings.HasPrefix(key, "stream_") && strings.HasSuffix(key, "_q") {
+			if quality, err := strconv.ParseFloat(value, 64); err == nil {
+				if p.Quality == nil {
+					p.Quality = map[string]float64{}
+				}
+				p.Quality[strings.TrimSuffix(strings.TrimPrefix(key, "stream_"), "_q")] = quality
+			}
+		}
+		return false
+	}
+}
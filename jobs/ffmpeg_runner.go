@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ffmpegKillGracePeriod = 10 * time.Second
+
+// FfmpegLimits keeps renders from starving the capture jobs. Zero values leave
+// ffmpeg's defaults in place.
+type FfmpegLimits struct {
+	Nice    int
+	Threads int
+}
+
+// apply adds the thread limit to outputArgs. libx265 keeps its own thread
+// pools, so for it the limit also goes into x265-params next to extraX265Params.
+func (l FfmpegLimits) apply(outputArgs ffmpeg.KwArgs, encoder string, extraX265Params ...string) {
+	x265Params := extraX265Params
+	if l.Threads > 0 {
+		outputArgs["threads"] = l.Threads
+		x265Params = append(x265Params, fmt.Sprintf("pools=%d", l.Threads))
+	}
+	if encoder == "libx265" && len(x265Params) > 0 {
+		outputArgs["x265-params"] = strings.Join(x265Params, ":")
+	}
+}
+
+func (l FfmpegLimits) command(cmd *exec.Cmd) *exec.Cmd {
+	if l.Nice == 0 {
+		return cmd
+	}
+	niced := exec.Command("nice", append([]string{"-n", strconv.Itoa(l.Nice), cmd.Path}, cmd.Args[1:]...)...)
+	niced.Stdin = cmd.Stdin
+	niced.Stdout = cmd.Stdout
+	niced.Stderr = cmd.Stderr
+	return niced
+}
+
+// runFfmpeg runs the compiled ffmpeg command until it exits or ctx is done. On
+// cancellation ffmpeg first gets SIGINT so it can finish writing, and SIGKILL
+// if it is still alive after ffmpegKillGracePeriod.
+func runFfmpeg(ctx context.Context, stream *ffmpeg.Stream, limits FfmpegLimits) error {
+	cmd := limits.command(stream.Compile())
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Interrupting ffmpeg %d: %v", cmd.Process.Pid, ctx.Err())
+	_ = cmd.Process.Signal(os.Interrupt)
+	select {
+	case <-done:
+	case <-time.After(ffmpegKillGracePeriod):
+		log.Printf("Killing ffmpeg %d", cmd.Process.Pid)
+		_ = cmd.Process.Kill()
+		<-done
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,103 @@
+package jobs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+	"timelapse_maker/constants"
+	"timelapse_maker/imaging"
+)
+
+const ingestJpegQuality = 92
+
+// FrameIngest is the single way a frame enters a camera's image tree, whether
+// it was downloaded or imported, so that privacy masks are always applied
+// before anything touches disk.
+type FrameIngest struct {
+	CameraName string
+	Frames     *FrameStore    //catalogues stored frames when set
+	Masks      []imaging.Mask //in pixels of the frame as captured
+	MaskStyle  imaging.MaskStyle
+	Crop       image.Rectangle //region of interest, the whole frame when empty
+	Width      int             //target size after cropping, 0 follows the aspect ratio
+	Height     int
+}
+
+func (i FrameIngest) transforms() bool {
+	return len(i.Masks) > 0 || !i.Crop.Empty() || i.Width > 0 || i.Height > 0
+}
+
+// Prepare returns the bytes to store for content: unchanged when there is
+// nothing to do, otherwise the decoded frame masked, cropped and resized, in
+// that order, encoded as JPEG.
+func (i FrameIngest) Prepare(content []byte) ([]byte, error) {
+	if !i.transforms() {
+		return content, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("decoding frame for ingest: %v", err))
+	}
+	if len(i.Masks) > 0 {
+		img = imaging.ApplyMasks(img, i.Masks, i.MaskStyle)
+	}
+	if !i.Crop.Empty() || i.Width > 0 || i.Height > 0 {
+		if img, err = imaging.CropAndResize(img, i.Crop, i.Width, i.Height); err != nil {
+			return nil, errors.New(fmt.Sprintf("cropping frame for ingest: %v", err))
+		}
+	}
+	var buffer bytes.Buffer
+	if err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: ingestJpegQuality}); err != nil {
+		return nil, errors.New(fmt.Sprintf("encoding ingested frame: %v", err))
+	}
+	return buffer.Bytes(), nil
+}
+
+// Store prepares content and writes it as the frame captured at capturedAt in
+// the period directory of the type. It returns the path and the stored bytes.
+func (i FrameIngest) Store(rootDirectory string, timelapseType *constants.TimelapseType, capturedAt time.Time,
+	content []byte, downloadLatency time.Duration) (string, []byte, error) {
+	prepared, err := i.Prepare(content)
+	if err != nil {
+		return "", nil, err
+	}
+	absoluteFilePath := filepath.Join(
+		rootDirectory,
+		timelapseType.Directory,
+		timelapseType.SubDirectoryNaming(capturedAt),
+		capturedAt.Format(FrameNameLayout))
+	file, err := create(absoluteFilePath)
+	if err != nil {
+		return "", nil, errors.New(fmt.Sprintf("touching file %s: %v", absoluteFilePath, err))
+	}
+	if _, err = file.Write(prepared); err != nil {
+		file.Close()
+		return "", nil, errors.New(fmt.Sprintf("saving image to file %s: %v", absoluteFilePath, err))
+	}
+	if err = file.Close(); err != nil {
+		return "", nil, err
+	}
+	log.Printf("Saved image sized %d to %s", len(prepared), absoluteFilePath)
+	if i.Frames != nil {
+		i.Frames.Record(i.CameraName, timelapseType, capturedAt, absoluteFilePath, prepared, downloadLatency)
+	}
+	return absoluteFilePath, prepared, nil
+}
+
+// IngestFile stores a frame that did not come from the camera downloader, for
+// example from another recorder, through the same masking as downloaded ones.
+func (i FrameIngest) IngestFile(path string, rootDirectory string, timelapseType *constants.TimelapseType,
+	capturedAt time.Time) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	stored, _, err := i.Store(rootDirectory, timelapseType, capturedAt, content, 0)
+	return stored, err
+}
@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+func testFrame(t *testing.T, width int, height int) []byte {
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestPrepareCropsAndResizes(t *testing.T) {
+	ingest := FrameIngest{Crop: image.Rect(100, 50, 500, 250), Width: 200}
+	prepared, err := ingest.Prepare(testFrame(t, 640, 480))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(prepared))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != 200 || config.Height != 100 {
+		t.Errorf("prepared frame is %dx%d, expected 200x100", config.Width, config.Height)
+	}
+}
+
+func TestPrepareRefusesCropOutsideTheFrame(t *testing.T) {
+	for _, crop := range []image.Rectangle{
+		image.Rect(1000, 800, 1400, 1000), //configured for a larger resolution
+		image.Rect(500, 300, 900, 600),    //overlapping the frame partly
+	} {
+		ingest := FrameIngest{Crop: crop, Width: 1280}
+		if _, err := ingest.Prepare(testFrame(t, 640, 480)); err == nil {
+			t.Errorf("crop %v of a 640x480 frame was accepted", crop)
+		}
+	}
+}
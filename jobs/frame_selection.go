@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"time"
+)
+
+// nearestFrame returns the frame whose capture time is closest to target, or
+// false if none of the frames has a parsable capture time.
+func nearestFrame(frames []string, target time.Time) (string, time.Duration, bool) {
+	var best string
+	var bestDistance time.Duration
+	found := false
+	for _, frame := range frames {
+		captured, err := frameCaptureTime(frame)
+		if err != nil {
+			continue
+		}
+		distance := captured.Sub(target)
+		if distance < 0 {
+			distance = -distance
+		}
+		if !found || distance < bestDistance {
+			best, bestDistance, found = frame, distance, true
+		}
+	}
+	return best, bestDistance, found
+}
@@ -0,0 +1,123 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"timelapse_maker/constants"
+	"timelapse_maker/imaging"
+)
+
+type FrameStatus string
+
+const (
+	FrameValid       FrameStatus = "valid"
+	FrameEmpty       FrameStatus = "empty"
+	FrameUndecodable FrameStatus = "undecodable"
+)
+
+// FrameRecord is one row of lig2.frames, the catalogue of every stored frame.
+type FrameRecord struct {
+	Camera          string
+	Type            string
+	Period          string
+	Path            string
+	CapturedAt      time.Time
+	DownloadLatency time.Duration
+	ByteSize        int
+	Width           int
+	Height          int
+	MeanLuminance   float64
+	Hash            string
+	Status          FrameStatus
+}
+
+type FrameStore struct {
+	DBPool *pgxpool.Pool
+}
+
+// analyzeFrame fills in what can be learned from the stored bytes of a frame.
+func analyzeFrame(record *FrameRecord, content []byte) {
+	record.ByteSize = len(content)
+	sum := sha256.Sum256(content)
+	record.Hash = hex.EncodeToString(sum[:])
+	if len(content) == 0 {
+		record.Status = FrameEmpty
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		record.Status = FrameUndecodable
+		return
+	}
+	record.Status = FrameValid
+	record.Width, record.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	record.MeanLuminance = imaging.MeanLuminance(img)
+}
+
+// Record analyzes content stored at path and saves it to the catalogue.
+func (s *FrameStore) Record(camera string, timelapseType *constants.TimelapseType, capturedAt time.Time,
+	path string, content []byte, downloadLatency time.Duration) {
+	abs, _ := filepath.Abs(path)
+	record := FrameRecord{
+		Camera:          camera,
+		Type:            timelapseType.Name,
+		Period:          timelapseType.SubDirectoryNaming(capturedAt),
+		Path:            abs,
+		CapturedAt:      capturedAt,
+		DownloadLatency: downloadLatency,
+	}
+	analyzeFrame(&record, content)
+	_, err := s.DBPool.Exec(context.Background(),
+		"INSERT INTO \"lig2\".frames (camera, type, period, file_path, captured_at, download_latency_ms, byte_size, "+
+			"width, height, mean_luminance, hash, status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) "+
+			"ON CONFLICT (file_path) DO UPDATE SET captured_at = $5, download_latency_ms = $6, byte_size = $7, "+
+			"width = $8, height = $9, mean_luminance = $10, hash = $11, status = $12, video_id = NULL",
+		record.Camera, record.Type, record.Period, record.Path, record.CapturedAt, record.DownloadLatency.Milliseconds(),
+		record.ByteSize, record.Width, record.Height, record.MeanLuminance, record.Hash, string(record.Status))
+	if err != nil {
+		log.Printf("Unable to save frame %s to database: %v", record.Path, err)
+	}
+}
+
+// linkFramesTx points the frames that went into a video at its row. Without
+// the list of used frames all frames of the period are linked.
+func linkFramesTx(tx pgx.Tx, videoID uint64, camera string, timelapseType string, period string,
+	frames []string) error {
+	var err error
+	if frames == nil {
+		_, err = tx.Exec(context.Background(),
+			"UPDATE \"lig2\".frames SET video_id = $1 WHERE camera = $2 AND type = $3 AND period = $4",
+			videoID, camera, timelapseType, period)
+	} else {
+		_, err = tx.Exec(context.Background(),
+			"UPDATE \"lig2\".frames SET video_id = $1 WHERE file_path = ANY($2)",
+			videoID, frames)
+	}
+	return err
+}
+
+func writeUsedFrames(path string, frames []string) error {
+	return os.WriteFile(path, []byte(strings.Join(frames, "\n")), 0660)
+}
+
+// readUsedFrames returns nil, and no error, when the list was never written.
+func readUsedFrames(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(string(content), "\n"), nil
+}
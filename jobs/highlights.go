@@ -0,0 +1,104 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"path/filepath"
+	"sort"
+	"time"
+	"timelapse_maker/imaging"
+)
+
+const motionSampleWidth = 160
+
+type HighlightSettings struct {
+	Sensitivity float64 //frames above mean + Sensitivity * stddev of the differences count as activity
+	MinFrames   int     //shorter bursts are ignored
+	MergeFrames int     //bursts closer than this are merged into one window
+	MaxClips    int
+}
+
+type highlightWindow struct {
+	start, end int //frame indexes, inclusive
+	score      float64
+}
+
+// createHighlights renders a clip for every burst of activity in frames, using
+// all frames of the window rather than the sampling of the main timelapse.
+func (g VideoMakerJob) createHighlights(ctx context.Context, videoID uint64, frames []string, targetVideoDirectory string) {
+	windows := findHighlightWindows(imaging.FrameDifferences(frames, motionSampleWidth), *g.Highlights)
+	if len(windows) == 0 {
+		log.Printf("No activity bursts found in %s", targetVideoDirectory)
+		return
+	}
+	for i, window := range windows {
+		if ctx.Err() != nil {
+			return
+		}
+		clipPath := filepath.Join(targetVideoDirectory, "highlights", fmt.Sprintf("highlight_%02d.mp4", i+1))
+		clipFrames := frames[window.start : window.end+1]
+		if _, err := encodeAndPublish(ctx, g.encoder(), g.ProgressListener, clipFrames, clipPath, g.TimelapseType.Profile); err != nil {
+			log.Printf("Error while rendering highlight %s: %v", clipPath, err)
+			continue
+		}
+		startsAt, _ := frameCaptureTime(clipFrames[0])
+		endsAt, _ := frameCaptureTime(clipFrames[len(clipFrames)-1])
+		if err := g.saveHighlightToDatabase(videoID, clipPath, startsAt, endsAt, window.score); err != nil {
+			log.Printf("Error while saving highlight %s to database: %v", clipPath, err)
+			continue
+		}
+		log.Printf("Saved highlight %s of %s - %s", clipPath, startsAt.Format(time.Kitchen), endsAt.Format(time.Kitchen))
+	}
+}
+
+func findHighlightWindows(differences []float64, settings HighlightSettings) []highlightWindow {
+	if len(differences) < 2 {
+		return nil
+	}
+	var sum, sumSquares float64
+	for _, d := range differences[1:] {
+		sum += d
+		sumSquares += d * d
+	}
+	n := float64(len(differences) - 1)
+	mean := sum / n
+	threshold := mean + settings.Sensitivity*math.Sqrt(math.Max(sumSquares/n-mean*mean, 0))
+
+	var windows []highlightWindow
+	for i := 1; i < len(differences); i++ {
+		if differences[i] <= threshold {
+			continue
+		}
+		// the frame before the jump belongs to the event as well
+		start := i - 1
+		if last := len(windows) - 1; last >= 0 && start-windows[last].end <= settings.MergeFrames {
+			windows[last].end = i
+			windows[last].score += differences[i]
+			continue
+		}
+		windows = append(windows, highlightWindow{start: start, end: i, score: differences[i]})
+	}
+
+	var long []highlightWindow
+	for _, window := range windows {
+		if window.end-window.start+1 >= settings.MinFrames {
+			long = append(long, window)
+		}
+	}
+	if settings.MaxClips > 0 && len(long) > settings.MaxClips {
+		sort.SliceStable(long, func(i, j int) bool {
+			return long[i].score > long[j].score
+		})
+		long = long[:settings.MaxClips]
+		sort.SliceStable(long, func(i, j int) bool {
+			return long[i].start < long[j].start
+		})
+	}
+	return long
+}
+
+func (g VideoMakerJob) saveHighlightToDatabase(videoID uint64, path string, startsAt time.Time, endsAt time.Time, score float64) error {
+	return g.renders().SaveHighlight(videoID, path, startsAt, endsAt, score)
+}
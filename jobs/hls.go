@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type HlsSettings struct {
+	SegmentSeconds int
+	SegmentType    string //fmp4 or mpegts
+	Renditions     []HlsRendition
+}
+
+type HlsRendition struct {
+	Width   int
+	Height  int
+	Bitrate string
+}
+
+// ParseHlsLadder reads a comma separated list of WIDTHxHEIGHT:BITRATE entries,
+// e.g. "1280x720:2500k,640x360:800k". An empty ladder means stream copy.
+func ParseHlsLadder(ladder string) ([]HlsRendition, error) {
+	var renditions []HlsRendition
+	for _, entry := range strings.Split(ladder, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var r HlsRendition
+		sizeAndBitrate := strings.Split(entry, ":")
+		if len(sizeAndBitrate) != 2 {
+			return nil, errors.New(fmt.Sprintf("invalid HLS rendition %s", entry))
+		}
+		if _, err := fmt.Sscanf(sizeAndBitrate[0], "%dx%d", &r.Width, &r.Height); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid HLS rendition size %s: %v", sizeAndBitrate[0], err))
+		}
+		r.Bitrate = sizeAndBitrate[1]
+		renditions = append(renditions, r)
+	}
+	return renditions, nil
+}
+
+func (g VideoMakerJob) createHls(ctx context.Context, videoID uint64, videoFilePath string, targetVideoDirectory string) {
+	hlsDirectory := filepath.Join(targetVideoDirectory, "hls")
+	if err := os.RemoveAll(hlsDirectory); err != nil {
+		log.Printf("Error while cleaning %s: %v", hlsDirectory, err)
+		return
+	}
+	if err := os.MkdirAll(hlsDirectory, os.ModePerm); err != nil {
+		log.Printf("Error while creating directory %s", hlsDirectory)
+		return
+	}
+
+	masterPlaylistPath := filepath.Join(hlsDirectory, "master.m3u8")
+	log.Printf("Starting to segment %s into %s", videoFilePath, masterPlaylistPath)
+	if err := runFfmpeg(ctx, g.hlsStream(videoFilePath, hlsDirectory).OverWriteOutput(), g.Limits); err != nil {
+		log.Printf("Error while creating HLS output: %v", err)
+		if err = os.RemoveAll(hlsDirectory); err != nil {
+			log.Printf("Error while removing partial HLS output %s: %v", hlsDirectory, err)
+		}
+		return
+	}
+	if err := g.saveArtifactToDatabase(videoID, "hls_master", masterPlaylistPath); err != nil {
+		log.Print("Error while saving HLS info to database")
+		return
+	}
+	log.Printf("Finished HLS output to %s", masterPlaylistPath)
+}
+
+func (g VideoMakerJob) hlsStream(videoFilePath string, hlsDirectory string) *ffmpeg.Stream {
+	settings := g.Hls
+	segmentExtension := "ts"
+	if settings.SegmentType == "fmp4" {
+		segmentExtension = "m4s"
+	}
+	outputArgs := ffmpeg.KwArgs{
+		"f":                    "hls",
+		"hls_time":             settings.SegmentSeconds,
+		"hls_playlist_type":    "vod",
+		"hls_segment_type":     settings.SegmentType,
+		"hls_segment_filename": filepath.Join(hlsDirectory, "stream_%v", "segment_%05d."+segmentExtension),
+		"master_pl_name":       "master.m3u8",
+	}
+	playlistPath := filepath.Join(hlsDirectory, "stream_%v", "playlist.m3u8")
+	input := ffmpeg.Input(videoFilePath)
+	// the background audio of the profile, already encoded in the video, goes
+	// into every variant
+	audio := g.TimelapseType.Profile.Audio != nil
+
+	if len(settings.Renditions) == 0 {
+		outputArgs["c"] = "copy"
+		outputArgs["tag:v"] = "hvc1"
+		outputArgs["var_stream_map"] = "v:0"
+		if audio {
+			outputArgs["var_stream_map"] = "v:0,a:0"
+		}
+		return input.Output(playlistPath, outputArgs)
+	}
+
+	split := input.Video().Split()
+	var streams []*ffmpeg.Stream
+	streamMap := make([]string, len(settings.Renditions))
+	for i, r := range settings.Renditions {
+		streams = append(streams, split.Get(strconv.Itoa(i)).Filter("scale", nil, ffmpeg.KwArgs{"w": r.Width, "h": r.Height}))
+		outputArgs[fmt.Sprintf("b:v:%d", i)] = r.Bitrate
+		streamMap[i] = fmt.Sprintf("v:%d", i)
+		if audio {
+			streams = append(streams, input.Audio())
+			streamMap[i] += fmt.Sprintf(",a:%d", i)
+		}
+	}
+	if audio {
+		outputArgs["c:a"] = "copy"
+	}
+	outputArgs["vcodec"] = "libx265"
+	outputArgs["tag:v"] = "hvc1"
+	g.Limits.apply(outputArgs, "libx265")
+	outputArgs["var_stream_map"] = strings.Join(streamMap, " ")
+	return ffmpeg.Output(streams, playlistPath, outputArgs)
+}
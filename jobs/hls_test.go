@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"strings"
+	"testing"
+	"timelapse_maker/constants"
+)
+
+func hlsArgs(renditions []HlsRendition, audio *constants.AudioSettings) string {
+	profile := constants.DefaultProfile
+	profile.Audio = audio
+	timelapseType := testType
+	timelapseType.Profile = &profile
+	job := VideoMakerJob{TimelapseType: &timelapseType, Hls: &HlsSettings{SegmentSeconds: 6, SegmentType: "fmp4", Renditions: renditions}}
+	return strings.Join(job.hlsStream("timelapse.mp4", "hls").GetArgs(), " ")
+}
+
+func TestHlsKeepsProfileAudioInEveryVariant(t *testing.T) {
+	audio := &constants.AudioSettings{File: "music.m4a", Bitrate: "128k"}
+	ladder := []HlsRendition{{Width: 1280, Height: 720, Bitrate: "2500k"}, {Width: 640, Height: 360, Bitrate: "800k"}}
+
+	for _, c := range []struct {
+		name      string
+		args      string
+		streamMap string
+		audioMaps int
+	}{
+		{"copy", hlsArgs(nil, audio), "-var_stream_map v:0,a:0 ", 0},
+		{"ladder", hlsArgs(ladder, audio), "-var_stream_map v:0,a:0 v:1,a:1 ", 2},
+		{"ladder without audio", hlsArgs(ladder, nil), "-var_stream_map v:0 v:1 ", 0},
+	} {
+		if !strings.Contains(c.args, c.streamMap) {
+			t.Errorf("%s: %q lacks %q", c.name, c.args, c.streamMap)
+		}
+		if maps := strings.Count(c.args, "-map 0:a"); maps != c.audioMaps {
+			t.Errorf("%s: audio is mapped %d times, expected %d", c.name, maps, c.audioMaps)
+		}
+	}
+}
+
+func TestHlsLadderScalesToEachRendition(t *testing.T) {
+	args := hlsArgs([]HlsRendition{{Width: 1280, Height: 720, Bitrate: "2500k"}}, nil)
+	if !strings.Contains(args, "scale=h=720:w=1280") {
+		t.Errorf("%q does not scale to 1280x720", args)
+	}
+}
@@ -1,8 +1,6 @@
 package jobs
 
 import (
-	"bytes"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -15,31 +13,25 @@ type ImageDownloadJob struct {
 	RootDirectory   string
 	TimelapseType   *constants.TimelapseType
 	ImageDownloader *utils.ImageDownloader
+	Ingest          FrameIngest
+	Movement        *CameraMovementDetector
 }
 
 func (g ImageDownloadJob) Run() {
 	log.Printf("Started job %s", g.TimelapseType.Name)
+	started := time.Now()
 	byteArray, err := g.ImageDownloader.DownloadAsByteArray()
 	if err != nil {
 		log.Printf("Error occured while loading image: %s", err.Error())
 		return
 	}
-	now := time.Now()
-	absoluteFilePath := filepath.Join(
-		g.RootDirectory,
-		g.TimelapseType.Directory,
-		g.TimelapseType.SubDirectoryNaming(now),
-		now.Format("02-01-2006 15_04_05.jpg"))
-	file, err := create(absoluteFilePath)
+	absoluteFilePath, stored, err := g.Ingest.Store(g.RootDirectory, g.TimelapseType, time.Now(), *byteArray, time.Since(started))
 	if err != nil {
-		log.Printf("Error occured while touching file %s. %s", absoluteFilePath, err.Error())
+		log.Printf("Error occured while storing image: %s", err.Error())
+		return
 	}
-
-	bytesWritten, err := io.Copy(file, bytes.NewReader(*byteArray))
-	if err != nil {
-		log.Printf("Error occured while saving image to file: %s", err.Error())
-	} else {
-		log.Printf("Saved image sized %d to %s", bytesWritten, absoluteFilePath)
+	if g.Movement != nil {
+		g.Movement.Check(absoluteFilePath, stored)
 	}
 }
 
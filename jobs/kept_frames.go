@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// KeptFramesDirectory holds, per day, the frames that outlive the day's images
+// so that season comparisons and year compilations can still find them.
+const KeptFramesDirectory = "kept_frames"
+
+type KeepFrameSettings struct {
+	TimeOfDay time.Duration //since midnight, the frame nearest to it is kept
+}
+
+func keptFramesDirectory(imagesRootDirectory string, day string) string {
+	return filepath.Join(imagesRootDirectory, KeptFramesDirectory, day)
+}
+
+// keepFrame copies the frame of the day nearest to the configured time of day
+// out of the images directory before it is removed.
+func (g VideoMakerJob) keepFrame(period string, frames []string) error {
+	start, _, err := g.TimelapseType.PeriodBounds(period)
+	if err != nil {
+		return err
+	}
+	frame, _, ok := nearestFrame(frames, start.Add(g.KeepFrame.TimeOfDay))
+	if !ok {
+		return errors.New(fmt.Sprintf("no frame of %s to keep", period))
+	}
+	content, err := os.ReadFile(frame)
+	if err != nil {
+		return err
+	}
+	keptFramePath := filepath.Join(keptFramesDirectory(g.ImagesRootDirectory, period), filepath.Base(frame))
+	if err = os.MkdirAll(filepath.Dir(keptFramePath), 0770); err != nil {
+		return err
+	}
+	if err = os.WriteFile(keptFramePath, content, 0660); err != nil {
+		return err
+	}
+	log.Printf("Kept %s as %s", frame, keptFramePath)
+	return nil
+}
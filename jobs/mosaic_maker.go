@@ -0,0 +1,216 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+	"timelapse_maker/constants"
+	"timelapse_maker/imaging"
+)
+
+const mosaicFrameQuality = 90
+
+// MosaicMakerJob renders the period of several cameras as one grid video. The
+// first camera drives the timeline; every other camera contributes its frame
+// nearest to each timestamp within Tolerance, or a placeholder tile.
+type MosaicMakerJob struct {
+	Context          context.Context
+	RootDirectory    string
+	Cameras          []Camera
+	TimelapseType    *constants.TimelapseType
+	Columns          int
+	Tolerance        time.Duration
+	DBPool           *pgxpool.Pool
+	Encoder          Encoder
+	ProgressListener func(p FFMpegProgress)
+	Queue            *RenderQueue
+}
+
+func (g MosaicMakerJob) Run() {
+	now := time.Now()
+	g.submit(g.TimelapseType.SubDirectoryNaming(now), time.Time{})
+	g.Reconcile(now)
+}
+
+// submit renders the period through the render queue, or right away when
+// there is no queue. Mosaics share the priority of their type; a period that
+// ended at ended is queued as a catch-up.
+func (g MosaicMakerJob) submit(period string, ended time.Time) {
+	render := func() {
+		if err := g.Render(period); err != nil {
+			log.Printf("Unable to render %s mosaic of %s: %v", g.TimelapseType.Name, period, err)
+		}
+	}
+	if g.Queue == nil {
+		render()
+	} else if ended.IsZero() {
+		g.Queue.SubmitKind(mosaicType(g.TimelapseType), g.TimelapseType.RenderPriority, period, render)
+	} else {
+		g.Queue.SubmitKindCatchUp(mosaicType(g.TimelapseType), g.TimelapseType.RenderPriority, period, ended, render)
+	}
+}
+
+func mosaicType(timelapseType *constants.TimelapseType) string {
+	return "MOSAIC_" + timelapseType.Name
+}
+
+func (g MosaicMakerJob) imagesDirectory(camera Camera, period string) string {
+	return filepath.Join(camera.ImagesRootDirectory, g.TimelapseType.Directory, period)
+}
+
+func (g MosaicMakerJob) videoFilePath(period string) string {
+	return filepath.Join(g.RootDirectory, "mosaic", g.TimelapseType.Directory, period, "timelapse.mp4")
+}
+
+// Reconcile handles ended periods whose images of mosaic-only cameras are still
+// on disk because the mosaic failed or was missed. The mosaic is rendered while
+// the first camera's frames exist; once they are gone it never can be, and the
+// leftover images are removed. The renders are queued as catch-ups, so run it
+// before RenderReconciler: the period's video catch-up then comes after the
+// mosaic and archives the first camera's frames only once it is rendered.
+func (g MosaicMakerJob) Reconcile(now time.Time) {
+	current := g.TimelapseType.SubDirectoryNaming(now)
+	for _, camera := range g.Cameras {
+		if !camera.MosaicOnly {
+			continue
+		}
+		entries, err := os.ReadDir(g.imagesDirectory(camera, ""))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("Unable to scan %s for leftover images: %v", g.imagesDirectory(camera, ""), err)
+			}
+			continue
+		}
+		for _, entry := range entries {
+			period := entry.Name()
+			if !entry.IsDir() || period == current {
+				continue
+			}
+			_, end, err := g.TimelapseType.PeriodBounds(period)
+			if err != nil || end.After(now) {
+				continue
+			}
+			g.reconcilePeriod(period, end)
+		}
+	}
+}
+
+func (g MosaicMakerJob) reconcilePeriod(period string, ended time.Time) {
+	if _, err := os.Stat(g.videoFilePath(period)); err == nil {
+		log.Printf("%s mosaic of %s exists, removing leftover images", g.TimelapseType.Name, period)
+		g.removeMosaicOnlyImages(period)
+		return
+	}
+	if _, err := listFrames(g.imagesDirectory(g.Cameras[0], period)); err == nil {
+		log.Printf("Catching up %s mosaic of %s", g.TimelapseType.Name, period)
+		g.submit(period, ended)
+		return
+	}
+	log.Printf("Frames of camera %s for %s are gone, the %s mosaic cannot be rendered, removing leftover images",
+		g.Cameras[0].Name, period, g.TimelapseType.Name)
+	g.removeMosaicOnlyImages(period)
+}
+
+func (g MosaicMakerJob) removeMosaicOnlyImages(period string) {
+	for _, camera := range g.Cameras {
+		if !camera.MosaicOnly {
+			continue
+		}
+		imagesDirectory := g.imagesDirectory(camera, period)
+		if err := os.RemoveAll(imagesDirectory); err != nil {
+			log.Printf("Error while removing images from %s due to %v", imagesDirectory, err)
+		}
+	}
+}
+
+func (g MosaicMakerJob) Render(period string) error {
+	ctx, cancel := context.WithTimeout(g.Context, g.TimelapseType.MaxRenderDuration)
+	defer cancel()
+
+	cameraFrames := make([][]string, len(g.Cameras))
+	for i, camera := range g.Cameras {
+		frames, err := listFrames(g.imagesDirectory(camera, period))
+		if err != nil {
+			log.Printf("No frames of camera %s for %s: %v", camera.Name, period, err)
+			continue
+		}
+		cameraFrames[i] = frames
+	}
+	if len(cameraFrames[0]) == 0 {
+		return errors.New(fmt.Sprintf("no frames of camera %s to drive the timeline", g.Cameras[0].Name))
+	}
+
+	composedDirectory, err := os.MkdirTemp("", "mosaic-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(composedDirectory)
+
+	composed, err := g.compose(ctx, cameraFrames, composedDirectory)
+	if err != nil {
+		return err
+	}
+
+	videoFilePath := g.videoFilePath(period)
+	metadata, err := encodeAndPublish(ctx, g.Encoder, g.ProgressListener, composed, videoFilePath, g.TimelapseType.Profile)
+	if err != nil {
+		return err
+	}
+	if err = g.saveInformationToDatabase(videoFilePath, metadata); err != nil {
+		return errors.New(fmt.Sprintf("saving info to database: %v", err))
+	}
+	log.Printf("Rendered %s mosaic of %d cameras to %s", g.TimelapseType.Name, len(g.Cameras), videoFilePath)
+
+	g.removeMosaicOnlyImages(period)
+	return nil
+}
+
+func (g MosaicMakerJob) compose(ctx context.Context, cameraFrames [][]string, composedDirectory string) ([]string, error) {
+	profile := g.TimelapseType.Profile
+	rows := (len(g.Cameras) + g.Columns - 1) / g.Columns
+	tileWidth, tileHeight := profile.Width/g.Columns, profile.Height/rows
+
+	labels := make([]string, len(g.Cameras))
+	for i, camera := range g.Cameras {
+		labels[i] = camera.Name
+	}
+
+	var composed []string
+	for _, driver := range cameraFrames[0] {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		captured, err := frameCaptureTime(driver)
+		if err != nil {
+			continue
+		}
+		tiles := make([]string, len(g.Cameras))
+		tiles[0] = driver
+		for i := 1; i < len(g.Cameras); i++ {
+			if frame, distance, ok := nearestFrame(cameraFrames[i], captured); ok && distance <= g.Tolerance {
+				tiles[i] = frame
+			}
+		}
+		path := filepath.Join(composedDirectory, captured.Format(FrameNameLayout))
+		if err = imaging.SaveJPEG(path, imaging.Mosaic(tiles, labels, g.Columns, tileWidth, tileHeight), mosaicFrameQuality); err != nil {
+			return nil, err
+		}
+		composed = append(composed, path)
+	}
+	return composed, nil
+}
+
+func (g MosaicMakerJob) saveInformationToDatabase(path string, metadata VideoMetadata) error {
+	abs, _ := filepath.Abs(path)
+	_, err := g.DBPool.Exec(context.Background(),
+		"INSERT INTO \"lig2\".videos (name, type, file_path, uploaded, duration_seconds, frame_count, codec, width, height) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		filepath.Base(filepath.Dir(path)), mosaicType(g.TimelapseType), abs, false,
+		metadata.DurationSeconds, metadata.FrameCount, metadata.Codec, metadata.Width, metadata.Height)
+	return err
+}
@@ -0,0 +1,60 @@
+package jobs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/gif"
+	"log"
+	"os"
+	"path/filepath"
+	"timelapse_maker/imaging"
+)
+
+const minPreviewFrames = 10
+
+type PreviewSettings struct {
+	Frames   int
+	Width    int
+	Delay    int //hundredths of a second
+	MaxBytes int
+}
+
+func (g VideoMakerJob) createPreview(videoID uint64, frames []string, targetVideoDirectory string) {
+	previewPath := filepath.Join(targetVideoDirectory, "preview.gif")
+	encoded, err := g.encodePreview(frames)
+	if err != nil {
+		log.Printf("Error while building preview: %v", err)
+		return
+	}
+	if err = os.WriteFile(previewPath, encoded, 0660); err != nil {
+		log.Printf("Error while saving preview to %s: %v", previewPath, err)
+		return
+	}
+	if err = g.saveArtifactToDatabase(videoID, "preview", previewPath); err != nil {
+		log.Print("Error while saving preview info to database")
+		return
+	}
+	log.Printf("Saved preview sized %d to %s", len(encoded), previewPath)
+}
+
+// encodePreview halves the number of sampled frames until the GIF fits into
+// MaxBytes or there are too few frames left to make a meaningful loop.
+func (g VideoMakerJob) encodePreview(frames []string) ([]byte, error) {
+	settings := g.Preview
+	for count := settings.Frames; count >= minPreviewFrames; count /= 2 {
+		preview, err := imaging.AnimatedPreview(sampleFrames(frames, count), settings.Width, settings.Delay)
+		if err != nil {
+			return nil, err
+		}
+		var buffer bytes.Buffer
+		if err = gif.EncodeAll(&buffer, preview); err != nil {
+			return nil, err
+		}
+		if settings.MaxBytes <= 0 || buffer.Len() <= settings.MaxBytes {
+			return buffer.Bytes(), nil
+		}
+		log.Printf("Preview of %d frames is %d bytes, over limit of %d", count, buffer.Len(), settings.MaxBytes)
+	}
+	return nil, errors.New(fmt.Sprintf("preview does not fit into %d bytes", settings.MaxBytes))
+}
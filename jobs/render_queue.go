@@ -0,0 +1,147 @@
+package jobs
+
+import (
+	"container/heap"
+	"context"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+	"timelapse_maker/constants"
+)
+
+var (
+	renderQueueDepth = expvar.NewInt("render_queue_depth")
+	rendersRunning   = expvar.NewInt("renders_running")
+)
+
+// RenderQueue runs submitted renders on a fixed number of workers, higher
+// TimelapseType.RenderPriority first and in submission order within a priority.
+// Catch-up renders of missed periods run before that, oldest period first
+// whatever their type: they are always older than the periods rendered on
+// schedule.
+type RenderQueue struct {
+	mutex   sync.Mutex
+	wakeup  *sync.Cond
+	items   renderItems
+	queued  map[string]bool
+	nextSeq uint64
+	workers sync.WaitGroup
+	ctx     context.Context
+}
+
+type renderItem struct {
+	key      string
+	priority int
+	ended    time.Time //end of the period for catch-up renders, zero otherwise
+	seq      uint64
+	run      func()
+}
+
+func NewRenderQueue(ctx context.Context, workers int) *RenderQueue {
+	q := &RenderQueue{queued: map[string]bool{}, ctx: ctx}
+	q.wakeup = sync.NewCond(&q.mutex)
+	for i := 0; i < workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+	go func() {
+		<-ctx.Done()
+		q.mutex.Lock()
+		q.wakeup.Broadcast()
+		q.mutex.Unlock()
+	}()
+	return q
+}
+
+// Submit queues run for the period unless the same period is already waiting.
+func (q *RenderQueue) Submit(timelapseType *constants.TimelapseType, period string, run func()) {
+	q.push(timelapseType.Name, timelapseType.RenderPriority, period, time.Time{}, run)
+}
+
+// SubmitCatchUp queues the render of a missed period that ended at ended.
+func (q *RenderQueue) SubmitCatchUp(timelapseType *constants.TimelapseType, period string, ended time.Time, run func()) {
+	q.push(timelapseType.Name, timelapseType.RenderPriority, period, ended, run)
+}
+
+// SubmitKind queues renders that are not a TimelapseType's own, such as
+// mosaics or compilations, so that they share the workers with it.
+func (q *RenderQueue) SubmitKind(kind string, priority int, period string, run func()) {
+	q.push(kind, priority, period, time.Time{}, run)
+}
+
+// SubmitKindCatchUp is SubmitCatchUp for renders that are not a
+// TimelapseType's own. Among catch-ups of periods that ended at the same time
+// the one submitted first runs first.
+func (q *RenderQueue) SubmitKindCatchUp(kind string, priority int, period string, ended time.Time, run func()) {
+	q.push(kind, priority, period, ended, run)
+}
+
+func (q *RenderQueue) push(kind string, priority int, period string, ended time.Time, run func()) {
+	key := kind + "/" + period
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.queued[key] {
+		log.Printf("%s render of %s is already queued", kind, period)
+		return
+	}
+	q.queued[key] = true
+	heap.Push(&q.items, &renderItem{key: key, priority: priority, ended: ended, seq: q.nextSeq, run: run})
+	q.nextSeq++
+	renderQueueDepth.Set(int64(q.items.Len()))
+	log.Printf("Queued %s render of %s, queue depth %d", kind, period, q.items.Len())
+	q.wakeup.Signal()
+}
+
+// Wait blocks until all workers have stopped after the queue's context is done.
+func (q *RenderQueue) Wait() {
+	q.workers.Wait()
+}
+
+func (q *RenderQueue) work() {
+	defer q.workers.Done()
+	for {
+		q.mutex.Lock()
+		for q.items.Len() == 0 && q.ctx.Err() == nil {
+			q.wakeup.Wait()
+		}
+		if q.ctx.Err() != nil {
+			q.mutex.Unlock()
+			return
+		}
+		item := heap.Pop(&q.items).(*renderItem)
+		delete(q.queued, item.key)
+		renderQueueDepth.Set(int64(q.items.Len()))
+		log.Printf("Starting render %s, queue depth %d", item.key, q.items.Len())
+		q.mutex.Unlock()
+
+		rendersRunning.Add(1)
+		item.run()
+		rendersRunning.Add(-1)
+	}
+}
+
+type renderItems []*renderItem
+
+func (r renderItems) Len() int { return len(r) }
+func (r renderItems) Less(i, j int) bool {
+	catchUpI, catchUpJ := !r[i].ended.IsZero(), !r[j].ended.IsZero()
+	if catchUpI != catchUpJ {
+		return catchUpI
+	}
+	if catchUpI && !r[i].ended.Equal(r[j].ended) {
+		return r[i].ended.Before(r[j].ended)
+	}
+	if r[i].priority != r[j].priority {
+		return r[i].priority > r[j].priority
+	}
+	return r[i].seq < r[j].seq
+}
+func (r renderItems) Swap(i, j int)       { r[i], r[j] = r[j], r[i] }
+func (r *renderItems) Push(x interface{}) { *r = append(*r, x.(*renderItem)) }
+func (r *renderItems) Pop() interface{} {
+	old := *r
+	item := old[len(old)-1]
+	*r = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"container/heap"
+	"context"
+	"testing"
+	"timelapse_maker/constants"
+)
+
+func TestRenderQueueRunsMosaicCatchUpBeforeVideoOfSamePeriod(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := NewRenderQueue(ctx, 0)
+	run := func() {}
+	_, dayEnd, _ := constants.Day.PeriodBounds("2026-10-16")
+	_, weekEnd, _ := constants.Week.PeriodBounds("2026-W41")
+
+	q.Submit(&constants.Day, "2026-10-18", run)
+	q.SubmitKindCatchUp(mosaicType(&constants.Day), constants.Day.RenderPriority, "2026-10-16", dayEnd, run)
+	q.SubmitCatchUp(&constants.Week, "2026-W41", weekEnd, run)
+	q.SubmitCatchUp(&constants.Day, "2026-10-16", dayEnd, run)
+
+	expected := []string{"WEEK/2026-W41", "MOSAIC_DAY/2026-10-16", "DAY/2026-10-16", "DAY/2026-10-18"}
+	for _, key := range expected {
+		if item := heap.Pop(&q.items).(*renderItem); item.key != key {
+			t.Errorf("%s ran where %s was expected", item.key, key)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// RenderReconciler finds periods whose images are still on disk although the
+// period has ended and no render was ever registered for them, e.g. because
+// the process was down when the video job was due.
+type RenderReconciler struct {
+	Makers map[string]VideoMakerJob
+}
+
+type missedPeriod struct {
+	maker  VideoMakerJob
+	period string
+	end    time.Time
+}
+
+func (r RenderReconciler) Run() {
+	missed := r.findMissedPeriods(time.Now())
+	if len(missed) == 0 {
+		log.Print("No missed periods to render")
+		return
+	}
+	for _, m := range missed {
+		log.Printf("Catching up %s render of %s that ended at %s", m.maker.TimelapseType.Name, m.period, m.end)
+		m.maker.CatchUp(m.period, m.end)
+	}
+}
+
+func (r RenderReconciler) findMissedPeriods(now time.Time) []missedPeriod {
+	var missed []missedPeriod
+	for _, maker := range r.Makers {
+		timelapseType := maker.TimelapseType
+		typeDirectory := maker.imagesDirectory("")
+		entries, err := os.ReadDir(typeDirectory)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("Unable to scan %s for missed periods: %v", typeDirectory, err)
+			}
+			continue
+		}
+
+		current := timelapseType.SubDirectoryNaming(now)
+		for _, entry := range entries {
+			period := entry.Name()
+			if !entry.IsDir() || period == current {
+				continue
+			}
+			_, end, err := timelapseType.PeriodBounds(period)
+			if err != nil {
+				log.Printf("Skipping %s in %s: %v", period, typeDirectory, err)
+				continue
+			}
+			if end.After(now) {
+				continue
+			}
+			_, err = maker.renders().Get(timelapseType.Name, period)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, ErrRenderNotFound) {
+				log.Printf("Unable to check %s render of %s: %v", timelapseType.Name, period, err)
+				continue
+			}
+			missed = append(missed, missedPeriod{maker: maker, period: period, end: end})
+		}
+	}
+
+	sort.Slice(missed, func(i, j int) bool {
+		return missed[i].end.Before(missed[j].end)
+	})
+	return missed
+}
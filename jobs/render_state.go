@@ -0,0 +1,265 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"log"
+	"os"
+	"time"
+)
+
+type RenderState string
+
+// A render moves through the states in this order. Failed keeps the state it
+// failed in as FailedState so that a retry resumes from that step. Blocked is
+// final until the render is forced: the period's coverage is too low.
+const (
+	RenderPending        RenderState = "pending"
+	RenderEncoding       RenderState = "encoding"
+	RenderEncoded        RenderState = "encoded"
+	RenderRecorded       RenderState = "recorded"
+	RenderImagesArchived RenderState = "images-archived"
+	RenderFailed         RenderState = "failed"
+	RenderBlocked        RenderState = "blocked"
+)
+
+var ErrRenderNotFound = errors.New("render not found")
+
+type Render struct {
+	ID            uint64
+	Type          string
+	Period        string
+	State         RenderState
+	FailedState   RenderState
+	Reason        string
+	Attempts      int
+	NextAttemptAt *time.Time
+	VideoID       *uint64
+	Forced        bool //rendered despite a coverage below the threshold
+}
+
+// resumeState is the step a render has to continue from.
+func (r Render) resumeState() RenderState {
+	if r.State == RenderFailed || r.State == RenderBlocked {
+		return r.FailedState
+	}
+	return r.State
+}
+
+func (r *Render) advanced(state RenderState) {
+	r.State = state
+	r.FailedState = ""
+	r.Reason = ""
+	r.NextAttemptAt = nil
+}
+
+type RenderStore struct {
+	DBPool *pgxpool.Pool
+}
+
+const renderColumns = "id, type, period, state, COALESCE(failed_state, ''), COALESCE(reason, ''), attempts, next_attempt_at, video_id, forced"
+
+func scanRender(row pgx.Row) (Render, error) {
+	var r Render
+	var state, failedState string
+	err := row.Scan(&r.ID, &r.Type, &r.Period, &state, &failedState, &r.Reason, &r.Attempts, &r.NextAttemptAt, &r.VideoID, &r.Forced)
+	r.State = RenderState(state)
+	r.FailedState = RenderState(failedState)
+	return r, err
+}
+
+// Create registers a pending render for the period unless one already exists,
+// and returns the persisted render either way.
+func (s RenderStore) Create(timelapseType string, period string) (Render, error) {
+	_, err := s.DBPool.Exec(context.Background(),
+		"INSERT INTO \"lig2\".renders (type, period, state) VALUES ($1, $2, $3) ON CONFLICT (type, period) DO NOTHING",
+		timelapseType, period, RenderPending)
+	if err != nil {
+		return Render{}, err
+	}
+	return s.Get(timelapseType, period)
+}
+
+func (s RenderStore) Get(timelapseType string, period string) (Render, error) {
+	render, err := scanRender(s.DBPool.QueryRow(context.Background(),
+		"SELECT "+renderColumns+" FROM \"lig2\".renders WHERE type = $1 AND period = $2",
+		timelapseType, period))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Render{}, ErrRenderNotFound
+	}
+	return render, err
+}
+
+// Due returns unfinished renders whose next attempt is not in the future,
+// skipping blocked ones, those that exhausted maxAttempts and those claimed by
+// a running render. Claims of a process that died lapse after their lease.
+func (s RenderStore) Due(now time.Time, maxAttempts int) ([]Render, error) {
+	rows, err := s.DBPool.Query(context.Background(),
+		"SELECT "+renderColumns+" FROM \"lig2\".renders "+
+			"WHERE state <> $1 AND state <> $2 AND attempts < $3 AND (next_attempt_at IS NULL OR next_attempt_at <= $4) "+
+			"AND (claimed_until IS NULL OR claimed_until < $4) "+
+			"ORDER BY id",
+		RenderImagesArchived, RenderBlocked, maxAttempts, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var renders []Render
+	for rows.Next() {
+		render, err := scanRender(rows)
+		if err != nil {
+			return nil, err
+		}
+		renders = append(renders, render)
+	}
+	return renders, rows.Err()
+}
+
+func (s RenderStore) Advance(render *Render, state RenderState) error {
+	_, err := s.DBPool.Exec(context.Background(),
+		"UPDATE \"lig2\".renders SET state = $1, failed_state = NULL, reason = NULL, next_attempt_at = NULL, updated_at = now() WHERE id = $2",
+		state, render.ID)
+	if err != nil {
+		return err
+	}
+	render.advanced(state)
+	return nil
+}
+
+// AdvanceTx is Advance inside a caller's transaction, for steps whose side
+// effects are database writes that must commit together with the new state.
+// The caller marks the render advanced once the transaction is committed.
+func (s RenderStore) AdvanceTx(tx pgx.Tx, render *Render, state RenderState, videoID uint64) error {
+	_, err := tx.Exec(context.Background(),
+		"UPDATE \"lig2\".renders SET state = $1, video_id = $2, failed_state = NULL, reason = NULL, next_attempt_at = NULL, updated_at = now() WHERE id = $3",
+		state, videoID, render.ID)
+	return err
+}
+
+func (s RenderStore) Fail(render *Render, reason error, backoff RenderBackoff) error {
+	failedState := render.resumeState()
+	attempts := render.Attempts + 1
+	nextAttemptAt := time.Now().Add(backoff.delay(attempts))
+	_, err := s.DBPool.Exec(context.Background(),
+		"UPDATE \"lig2\".renders SET state = $1, failed_state = $2, reason = $3, attempts = $4, next_attempt_at = $5, updated_at = now() WHERE id = $6",
+		RenderFailed, failedState, reason.Error(), attempts, nextAttemptAt, render.ID)
+	if err != nil {
+		return err
+	}
+	render.State = RenderFailed
+	render.FailedState = failedState
+	render.Reason = reason.Error()
+	render.Attempts = attempts
+	render.NextAttemptAt = &nextAttemptAt
+	return nil
+}
+
+// Block parks the render until it is forced; it is not retried.
+func (s RenderStore) Block(render *Render, reason error) error {
+	blockedState := render.resumeState()
+	_, err := s.DBPool.Exec(context.Background(),
+		"UPDATE \"lig2\".renders SET state = $1, failed_state = $2, reason = $3, next_attempt_at = NULL, updated_at = now() WHERE id = $4",
+		RenderBlocked, blockedState, reason.Error(), render.ID)
+	if err != nil {
+		return err
+	}
+	render.State = RenderBlocked
+	render.FailedState = blockedState
+	render.Reason = reason.Error()
+	render.NextAttemptAt = nil
+	return nil
+}
+
+// Force lets the render continue despite its coverage, with fresh attempts.
+func (s RenderStore) Force(render *Render) error {
+	state := render.State
+	if state == RenderBlocked {
+		state = RenderFailed
+	}
+	_, err := s.DBPool.Exec(context.Background(),
+		"UPDATE \"lig2\".renders SET state = $1, forced = true, attempts = 0, next_attempt_at = NULL, updated_at = now() WHERE id = $2",
+		state, render.ID)
+	if err != nil {
+		return err
+	}
+	render.State = state
+	render.Forced = true
+	render.Attempts = 0
+	render.NextAttemptAt = nil
+	return nil
+}
+
+type RenderBackoff struct {
+	Initial     time.Duration
+	Max         time.Duration
+	MaxAttempts int
+}
+
+func (b RenderBackoff) delay(attempts int) time.Duration {
+	delay := b.Initial
+	for i := 1; i < attempts && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		return b.Max
+	}
+	return delay
+}
+
+// renderOwner identifies this process in the claims it holds, so that the
+// daemon and a render command do not drive the same render.
+var renderOwner = func() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}()
+
+// Claim takes the render for this process until lease has passed, unless
+// another claim on it is still running. The claimed render is returned with
+// its current state; ok is false when someone else holds it.
+func (s RenderStore) Claim(timelapseType string, period string, lease time.Duration) (Render, bool, error) {
+	now := time.Now()
+	render, err := scanRender(s.DBPool.QueryRow(context.Background(),
+		"UPDATE \"lig2\".renders SET claimed_by = $1, claimed_until = $2 "+
+			"WHERE type = $3 AND period = $4 AND (claimed_until IS NULL OR claimed_until < $5) "+
+			"RETURNING "+renderColumns,
+		renderOwner, now.Add(lease), timelapseType, period, now))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Render{}, false, nil
+	}
+	return render, err == nil, err
+}
+
+// Release gives up this process' claim on the render.
+func (s RenderStore) Release(render *Render) error {
+	_, err := s.DBPool.Exec(context.Background(),
+		"UPDATE \"lig2\".renders SET claimed_by = NULL, claimed_until = NULL WHERE id = $1 AND claimed_by = $2",
+		render.ID, renderOwner)
+	return err
+}
+
+type RenderRetryJob struct {
+	DBPool  *pgxpool.Pool
+	Backoff RenderBackoff
+	Makers  map[string]VideoMakerJob
+}
+
+func (g RenderRetryJob) Run() {
+	renders, err := RenderStore{DBPool: g.DBPool}.Due(time.Now(), g.Backoff.MaxAttempts)
+	if err != nil {
+		log.Printf("Unable to load renders to retry: %v", err)
+		return
+	}
+	for _, render := range renders {
+		maker, ok := g.Makers[render.Type]
+		if !ok {
+			log.Printf("No video maker for %s render of %s", render.Type, render.Period)
+			continue
+		}
+		log.Printf("Resuming %s render of %s from %s (attempt %d)", render.Type, render.Period, render.resumeState(), render.Attempts+1)
+		maker.Render(render.Period)
+	}
+}
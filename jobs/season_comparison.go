@@ -0,0 +1,228 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+	"timelapse_maker/constants"
+)
+
+const SeasonComparisonType = "SEASON_COMPARISON"
+
+// seasonComparisonPriority puts comparisons behind every period render.
+const seasonComparisonPriority = 0
+
+// SeasonComparison describes one render: for every day From..To (inclusive)
+// the frame closest to TimeOfDay, optionally stacked left to right with the
+// same calendar days of CompareYear.
+type SeasonComparison struct {
+	TimeOfDay   time.Duration //since midnight
+	From        time.Time
+	To          time.Time
+	CompareYear int //0 for a single column
+	Tolerance   time.Duration
+}
+
+func (c SeasonComparison) name() string {
+	name := fmt.Sprintf("%02d%02d_%s_%s", int(c.TimeOfDay.Hours()), int(c.TimeOfDay.Minutes())%60,
+		c.From.Format("2006-01-02"), c.To.Format("2006-01-02"))
+	if c.CompareYear != 0 {
+		name += fmt.Sprintf("_vs_%d", c.CompareYear)
+	}
+	return name
+}
+
+// SeasonComparisonJob renders the comparison for the last Days days every time
+// it is scheduled; Compare can also be called on demand.
+type SeasonComparisonJob struct {
+	Context             context.Context
+	RootDirectory       string
+	ImagesRootDirectory string
+	DBPool              *pgxpool.Pool
+	Encoder             Encoder
+	Limits              FfmpegLimits
+	ProgressListener    func(p FFMpegProgress)
+	TimeOfDay           time.Duration
+	Days                int
+	CompareYears        int //years back to stack next to the current one, 0 to disable
+	Tolerance           time.Duration
+	Queue               *RenderQueue
+}
+
+func (g SeasonComparisonJob) Run() {
+	today := time.Now()
+	comparison := SeasonComparison{
+		TimeOfDay: g.TimeOfDay,
+		From:      today.AddDate(0, 0, -g.Days),
+		To:        today,
+		Tolerance: g.Tolerance,
+	}
+	if g.CompareYears > 0 {
+		comparison.CompareYear = today.Year() - g.CompareYears
+	}
+	compare := func() {
+		if _, err := g.Compare(comparison); err != nil {
+			log.Printf("Unable to render season comparison %s: %v", comparison.name(), err)
+		}
+	}
+	if g.Queue == nil {
+		compare()
+		return
+	}
+	g.Queue.SubmitKind(SeasonComparisonType, seasonComparisonPriority, comparison.name(), compare)
+}
+
+func (g SeasonComparisonJob) Compare(comparison SeasonComparison) (string, error) {
+	frames, err := indexFramesByDay(g.ImagesRootDirectory)
+	if err != nil {
+		return "", err
+	}
+
+	var left, right []string
+	for day := startOfDay(comparison.From); !day.After(comparison.To); day = day.AddDate(0, 0, 1) {
+		frame, ok := frameAtTimeOfDay(frames, day, comparison)
+		if !ok {
+			continue
+		}
+		if comparison.CompareYear == 0 {
+			left = append(left, frame)
+			continue
+		}
+		compareDay := time.Date(comparison.CompareYear, day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+		compareFrame, ok := frameAtTimeOfDay(frames, compareDay, comparison)
+		if !ok {
+			continue
+		}
+		left = append(left, frame)
+		right = append(right, compareFrame)
+	}
+	if len(left) == 0 {
+		return "", errors.New(fmt.Sprintf("no frames within %s of %s for %s", comparison.Tolerance, comparison.TimeOfDay, comparison.name()))
+	}
+
+	ctx, cancel := context.WithTimeout(g.Context, constants.Quarter.MaxRenderDuration)
+	defer cancel()
+
+	encoder := g.Encoder
+	if comparison.CompareYear != 0 {
+		encoder = hstackEncoder{Right: right, Limits: g.Limits}
+	}
+	videoFilePath := filepath.Join(g.RootDirectory, "season_comparisons", comparison.name(), "timelapse.mp4")
+	metadata, err := encodeAndPublish(ctx, encoder, g.ProgressListener, left, videoFilePath, &constants.DefaultProfile)
+	if err != nil {
+		return "", err
+	}
+	if err = g.saveInformationToDatabase(videoFilePath, metadata); err != nil {
+		return "", errors.New(fmt.Sprintf("saving info to database: %v", err))
+	}
+	log.Printf("Rendered season comparison of %d days to %s", len(left), videoFilePath)
+	return videoFilePath, nil
+}
+
+func (g SeasonComparisonJob) saveInformationToDatabase(path string, metadata VideoMetadata) error {
+	abs, _ := filepath.Abs(path)
+	_, err := g.DBPool.Exec(context.Background(),
+		"INSERT INTO \"lig2\".videos (name, type, file_path, uploaded, duration_seconds, frame_count, codec, width, height) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		filepath.Base(filepath.Dir(path)), SeasonComparisonType, abs, false,
+		metadata.DurationSeconds, metadata.FrameCount, metadata.Codec, metadata.Width, metadata.Height)
+	return err
+}
+
+func frameAtTimeOfDay(frames map[string][]string, day time.Time, comparison SeasonComparison) (string, bool) {
+	frame, distance, ok := nearestFrame(frames[day.Format("2006-01-02")], startOfDay(day).Add(comparison.TimeOfDay))
+	return frame, ok && distance <= comparison.Tolerance
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// indexFramesByDay collects frames from the period directories of every
+// TimelapseType image tree and from the kept frames, keyed by capture date.
+// Images are removed once their period is rendered, so older days are only
+// found through their kept frame.
+func indexFramesByDay(imagesRootDirectory string) (map[string][]string, error) {
+	periodDirectories, err := filepath.Glob(filepath.Join(imagesRootDirectory, "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+	index := map[string][]string{}
+	for _, directory := range periodDirectories {
+		frames, err := listFrames(directory)
+		if err != nil {
+			continue
+		}
+		for _, frame := range frames {
+			if captured, err := frameCaptureTime(frame); err == nil {
+				day := captured.Format("2006-01-02")
+				index[day] = append(index[day], frame)
+			}
+		}
+	}
+	for _, frames := range index {
+		sort.Strings(frames)
+	}
+	return index, nil
+}
+
+// hstackEncoder encodes the request's frames on the left and Right on the
+// right half of the picture, frame by frame.
+type hstackEncoder struct {
+	Right  []string
+	Limits FfmpegLimits
+}
+
+func (e hstackEncoder) Encode(ctx context.Context, request EncodeRequest, progress func(p FFMpegProgress)) error {
+	profile := request.Profile
+	listener, socketError := listenFfmpegProgress(uint64(len(request.Frames)), progress)
+	if socketError != nil {
+		log.Printf("Error while opening socket for listening ffmpeg progress: %v", socketError)
+	} else {
+		defer listener.close()
+	}
+
+	leftFile, err := createFrameOrderFile(request.Frames, profile.Framerate)
+	if err != nil {
+		return err
+	}
+	defer removeTemporaryFile(leftFile)
+	rightFile, err := createFrameOrderFile(e.Right, profile.Framerate)
+	if err != nil {
+		return err
+	}
+	defer removeTemporaryFile(rightFile)
+
+	inputArgs := ffmpeg.KwArgs{"r": fmt.Sprintf("%d/1", profile.Framerate), "safe": 0, "f": "concat"}
+	left := fitInto(ffmpeg.Input(leftFile, inputArgs), profile.Width/2, profile.Height)
+	right := fitInto(ffmpeg.Input(rightFile, inputArgs), profile.Width/2, profile.Height)
+	outputArgs := ffmpeg.KwArgs{"crf": profile.Crf, "vcodec": profile.Encoder}
+	if socketError == nil {
+		outputArgs["progress"] = listener.url()
+	}
+	e.Limits.apply(outputArgs, profile.Encoder)
+
+	stream := ffmpeg.Filter([]*ffmpeg.Stream{left, right}, "hstack", nil).
+		Output(request.OutputPath, outputArgs).
+		OverWriteOutput()
+	return runFfmpeg(ctx, stream, e.Limits)
+}
+
+// fitInto scales the stream to fit width x height keeping its aspect ratio and
+// pads the rest with black.
+func fitInto(stream *ffmpeg.Stream, width int, height int) *ffmpeg.Stream {
+	return stream.
+		Filter("scale", nil, ffmpeg.KwArgs{"w": width, "h": height,
+			"force_original_aspect_ratio": "decrease", "force_divisible_by": 2}).
+		Filter("pad", nil, ffmpeg.KwArgs{"w": width, "h": height, "x": "(ow-iw)/2", "y": "(oh-ih)/2"})
+}
+
+func (e hstackEncoder) Probe(path string) (VideoMetadata, error) {
+	return probeVideo(path)
+}
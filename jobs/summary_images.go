@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"path/filepath"
+	"timelapse_maker/imaging"
+)
+
+const colourStripHeight = 100
+
+// ContactSheetSettings lays out the contact sheet of a period: Columns x Rows
+// evenly spaced frames, each scaled to TileWidth.
+type ContactSheetSettings struct {
+	Columns   int
+	Rows      int
+	TileWidth int
+}
+
+// ParseContactSheetGrid reads a COLUMNSxROWS grid, e.g. "6x4".
+func ParseContactSheetGrid(grid string) (int, int, error) {
+	var columns, rows int
+	if _, err := fmt.Sscanf(grid, "%dx%d", &columns, &rows); err != nil {
+		return 0, 0, errors.New(fmt.Sprintf("contact sheet grid %q must be COLUMNSxROWS: %v", grid, err))
+	}
+	if columns <= 0 || rows <= 0 {
+		return 0, 0, errors.New(fmt.Sprintf("contact sheet grid %q must have positive sides", grid))
+	}
+	return columns, rows, nil
+}
+
+func (g VideoMakerJob) createSummaryImages(videoID uint64, frames []string, targetVideoDirectory string) {
+	keogramPath := filepath.Join(targetVideoDirectory, "keogram.png")
+	if keogram, err := imaging.Keogram(frames); err != nil {
+		log.Printf("Error while building keogram: %v", err)
+	} else {
+		g.saveSummaryImage(videoID, "keogram", keogramPath, keogram)
+	}
+
+	colourStripPath := filepath.Join(targetVideoDirectory, "colour_strip.png")
+	if strip, err := imaging.ColourStrip(frames, colourStripHeight); err != nil {
+		log.Printf("Error while building colour strip: %v", err)
+	} else {
+		g.saveSummaryImage(videoID, "colour_strip", colourStripPath, strip)
+	}
+}
+
+func (g VideoMakerJob) createContactSheet(videoID uint64, frames []string, targetVideoDirectory string) {
+	layout := g.ContactSheet
+	tiles := sampleFrames(frames, layout.Columns*layout.Rows)
+	labels := make([]string, len(tiles))
+	for i, tile := range tiles {
+		if captured, err := frameCaptureTime(tile); err == nil {
+			labels[i] = captured.Format("2006-01-02 15:04")
+		}
+	}
+
+	contactSheetPath := filepath.Join(targetVideoDirectory, "contact_sheet.png")
+	if sheet, err := imaging.ContactSheet(tiles, labels, layout.Columns, layout.TileWidth); err != nil {
+		log.Printf("Error while building contact sheet: %v", err)
+	} else {
+		g.saveSummaryImage(videoID, "contact_sheet", contactSheetPath, sheet)
+	}
+}
+
+func (g VideoMakerJob) saveSummaryImage(videoID uint64, kind string, path string, img image.Image) {
+	if err := imaging.SavePNG(path, img); err != nil {
+		log.Printf("Error while saving %s to %s: %v", kind, path, err)
+		return
+	}
+	if err := g.saveArtifactToDatabase(videoID, kind, path); err != nil {
+		log.Printf("Error while saving %s info to database", kind)
+		return
+	}
+	log.Printf("Saved %s to %s", kind, path)
+}
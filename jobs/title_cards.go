@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"path/filepath"
+	"timelapse_maker/constants"
+	"timelapse_maker/imaging"
+)
+
+const titleCardQuality = 95
+
+type TitleCardSettings struct {
+	Seconds    int
+	OutroImage string //optional, e.g. a logo shown for Seconds at the end
+}
+
+// wrap renders the intro card, and the outro if configured, into directory at
+// the profile's resolution and returns frames with them repeated for Seconds
+// at the start and end, so they go through the same encode as the images.
+func (s TitleCardSettings) wrap(frames []string, directory string, cameraName string, period string,
+	profile *constants.EncodingProfile) ([]string, error) {
+	repeat := s.Seconds * profile.Framerate
+
+	introPath := filepath.Join(directory, "intro.jpg")
+	intro := imaging.TitleCard(profile.Width, profile.Height, []string{cameraName, period})
+	if err := imaging.SaveJPEG(introPath, intro, titleCardQuality); err != nil {
+		return nil, err
+	}
+	wrapped := make([]string, 0, len(frames)+2*repeat)
+	for i := 0; i < repeat; i++ {
+		wrapped = append(wrapped, introPath)
+	}
+	wrapped = append(wrapped, frames...)
+
+	if s.OutroImage == "" {
+		return wrapped, nil
+	}
+	logo, err := imaging.LoadImage(s.OutroImage)
+	if err != nil {
+		return nil, err
+	}
+	outroPath := filepath.Join(directory, "outro.jpg")
+	if err = imaging.SaveJPEG(outroPath, imaging.Letterbox(logo, profile.Width, profile.Height), titleCardQuality); err != nil {
+		return nil, err
+	}
+	for i := 0; i < repeat; i++ {
+		wrapped = append(wrapped, outroPath)
+	}
+	return wrapped, nil
+}
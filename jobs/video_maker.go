@@ -1,267 +1,415 @@
 package jobs
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/jackc/pgx/v4/pgxpool"
-	ffmpeg "github.com/u2takey/ffmpeg-go"
 	"log"
-	"net"
 	"os"
 	"path/filepath"
-	Mregexp "regexp"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 	"timelapse_maker/constants"
 )
 
-var Continue = &ProgressStatus{"continue"}
-var End = &ProgressStatus{"end"}
-var bitrateRegex = Mregexp.MustCompile(`(\d+(?:\.\d+)?)kbits/s`)
-
-type FFMpegProgress struct {
-	Frame      uint16
-	Fps        string
-	Bitrate    uint32 //bit per second
-	TotalSize  uint32 //bytes
-	OutTimeMc  uint32 //micros passed
-	DupFrames  uint8
-	DropFrames uint8
-	Speed      string
-	Status     *ProgressStatus
-}
+const FrameNameLayout = "02-01-2006 15_04_05.jpg"
 
-type ProgressStatus struct {
-	Name string
-}
+// renderClaimMargin covers the database writes a render does after its
+// MaxRenderDuration context is done, so that its claim does not lapse early.
+const renderClaimMargin = 5 * time.Minute
 
 type VideoMakerJob struct {
+	Context             context.Context
+	CameraName          string
 	RootDirectory       string
 	ImagesRootDirectory string
 	TimelapseType       *constants.TimelapseType
 	DBPool              *pgxpool.Pool
+	Renders             RenderRepository //RenderStore on DBPool when nil
 	ProgressListener    func(p FFMpegProgress)
+	Preview             *PreviewSettings
+	ContactSheet        *ContactSheetSettings
+	Hls                 *HlsSettings
+	Backoff             RenderBackoff
+	Queue               *RenderQueue
+	Limits              FfmpegLimits
+	Encoder             Encoder //FfmpegEncoder with Limits when nil
+	TitleCards          *TitleCardSettings
+	Highlights          *HighlightSettings
+	BestFrames          *BestFrameSettings
+	Coverage            *CoverageSettings
+	KeepFrame           *KeepFrameSettings
 }
 
 func (g VideoMakerJob) Run() {
-	listener, socketError := net.Listen("tcp", "127.0.0.1:0")
-	if socketError != nil {
-		log.Printf("Error while opening socket for listening ffmpeg progress")
+	g.Render(g.TimelapseType.SubDirectoryNaming(time.Now()))
+}
+
+// Render registers a render for the period, if there is none yet, and hands it
+// to the render queue, or drives it right away when there is no queue.
+func (g VideoMakerJob) Render(period string) {
+	g.render(period, time.Time{})
+}
+
+// CatchUp is Render for a missed period that ended at ended; the queue runs
+// catch-ups oldest first across types.
+func (g VideoMakerJob) CatchUp(period string, ended time.Time) {
+	g.render(period, ended)
+}
+
+func (g VideoMakerJob) render(period string, ended time.Time) {
+	if _, err := g.renders().Create(g.TimelapseType.Name, period); err != nil {
+		log.Printf("Unable to register %s render of %s: %v", g.TimelapseType.Name, period, err)
+		return
+	}
+	run := func() {
+		g.Resume(period)
+	}
+	if g.Queue == nil {
+		run()
+	} else if ended.IsZero() {
+		g.Queue.Submit(g.TimelapseType, period, run)
 	} else {
-		defer listener.Close()
-		log.Println("Preparing to listen ffmpeg progress on ", listener.Addr().String())
-		go g.handleFfmpegProgress(listener)
+		g.Queue.SubmitCatchUp(g.TimelapseType, period, ended, run)
 	}
+}
 
-	now := time.Now()
-	subDirectoryName := g.TimelapseType.SubDirectoryNaming(now)
-	imagesToCollectDirectory := filepath.Join(
-		g.ImagesRootDirectory,
-		g.TimelapseType.Directory,
-		subDirectoryName)
-
-	file, err := createFrameOrderFile(imagesToCollectDirectory)
+// Force renders the period right away although its coverage is below the
+// threshold, unblocking a blocked render. When another process has claimed it
+// meanwhile, that process renders it forced instead.
+func (g VideoMakerJob) Force(period string) {
+	render, err := g.renders().Create(g.TimelapseType.Name, period)
+	if err == nil {
+		err = g.renders().Force(&render)
+	}
 	if err != nil {
-		log.Print(err)
+		log.Printf("Unable to force %s render of %s: %v", g.TimelapseType.Name, period, err)
 		return
 	}
+	g.Resume(period)
+}
 
-	log.Printf("Prepared Frame order in file %s", file)
-	targetVideoDirectory := filepath.Join(g.RootDirectory, g.TimelapseType.Directory, subDirectoryName)
-	err = os.MkdirAll(targetVideoDirectory, os.ModePerm)
+// Resume drives the period's render from its persisted state until the images
+// are archived or a step fails. A failed step is recorded with a backoff and
+// picked up again by RenderRetryJob. The render is claimed in the database
+// meanwhile, so no other goroutine or process drives it at the same time.
+func (g VideoMakerJob) Resume(period string) {
+	render, ok, err := g.renders().Claim(g.TimelapseType.Name, period, g.TimelapseType.MaxRenderDuration+renderClaimMargin)
 	if err != nil {
-		log.Printf("Error while creating directory %s", targetVideoDirectory)
+		log.Printf("Unable to claim %s render of %s: %v", g.TimelapseType.Name, period, err)
+		return
+	}
+	if !ok {
+		log.Printf("%s render of %s is already in progress", g.TimelapseType.Name, period)
 		return
 	}
-
-	videoFilePath := filepath.Join(targetVideoDirectory, "timelapse.mp4")
-	var videoCreated = false
 	defer func() {
-		if videoCreated {
-			if g.saveInformationToDatabase(videoFilePath) != nil {
-				log.Print("Error while saving info to database")
-			} else {
-				log.Printf("Saved information about %s in database", videoFilePath)
-				err2 := os.RemoveAll(imagesToCollectDirectory)
-				if err2 != nil {
-					log.Printf("Error while removing images from %s due to %v", imagesToCollectDirectory, err2)
+		if err := g.renders().Release(&render); err != nil {
+			log.Printf("Unable to release %s render of %s: %v", g.TimelapseType.Name, period, err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(g.Context, g.TimelapseType.MaxRenderDuration)
+	defer cancel()
+
+	if render.State == RenderBlocked {
+		log.Printf("%s render of %s is blocked (%s), force it to render anyway", g.TimelapseType.Name, period, render.Reason)
+		return
+	}
+	for render.State != RenderImagesArchived {
+		if err = g.step(ctx, &render); err != nil {
+			var coverageError CoverageTooLowError
+			if errors.As(err, &coverageError) {
+				log.Printf("%s render of %s is blocked: %v", g.TimelapseType.Name, period, err)
+				if err = g.renders().Block(&render, err); err != nil {
+					log.Printf("Unable to save block of %s render of %s: %v", g.TimelapseType.Name, period, err)
 				}
+				return
 			}
+			log.Printf("%s render of %s failed at %s: %v", g.TimelapseType.Name, period, render.resumeState(), err)
+			if err = g.renders().Fail(&render, err, g.Backoff); err != nil {
+				log.Printf("Unable to save failure of %s render of %s: %v", g.TimelapseType.Name, period, err)
+			}
+			return
 		}
-	}()
-	log.Printf("Starting to creating video from images to %s", videoFilePath)
+	}
+	log.Printf("%s render of %s is complete", g.TimelapseType.Name, period)
+}
 
-	inputArgs := ffmpeg.KwArgs{"r": "5/1", "safe": 0, "f": "concat"}
-	if socketError == nil {
-		inputArgs["progress"] = "tcp://" + listener.Addr().String()
+func (g VideoMakerJob) step(ctx context.Context, render *Render) error {
+	switch render.resumeState() {
+	case RenderPending, RenderEncoding:
+		if err := g.renders().Advance(render, RenderEncoding); err != nil {
+			return err
+		}
+		if err := g.encode(ctx, render.Period, render.Forced); err != nil {
+			return err
+		}
+		return g.renders().Advance(render, RenderEncoded)
+	case RenderEncoded:
+		return g.record(render)
+	case RenderRecorded:
+		return g.archive(ctx, render)
+	default:
+		return errors.New(fmt.Sprintf("unknown render state %s", render.resumeState()))
 	}
-	outputArgs := ffmpeg.KwArgs{"crf": 28, "s": "1280x720", "vcodec": "libx265"}
+}
 
-	err = ffmpeg.Input(file, inputArgs).Output(videoFilePath, outputArgs).OverWriteOutput().Run()
-	if err != nil {
-		log.Print("Error while creating video from images")
-		return
+func (g VideoMakerJob) encoder() Encoder {
+	if g.Encoder != nil {
+		return g.Encoder
 	}
-	videoCreated = true
-	log.Printf("Finished creating video from images to %s", videoFilePath)
+	return FfmpegEncoder{Limits: g.Limits}
 }
 
-func (g VideoMakerJob) handleFfmpegProgress(lis net.Listener) {
-	c, err := lis.Accept()
-	if err != nil {
-		log.Printf("Error while accepting connection using %s : %v", lis.Addr().String(), err)
-		return
+func (g VideoMakerJob) renders() RenderRepository {
+	if g.Renders != nil {
+		return g.Renders
 	}
-	defer c.Close()
+	return RenderStore{DBPool: g.DBPool}
+}
+
+func (g VideoMakerJob) imagesDirectory(period string) string {
+	return filepath.Join(g.ImagesRootDirectory, g.TimelapseType.Directory, period)
+}
+
+func (g VideoMakerJob) videoDirectory(period string) string {
+	return filepath.Join(g.RootDirectory, g.TimelapseType.Directory, period)
+}
+
+func (g VideoMakerJob) videoFilePath(period string) string {
+	return filepath.Join(g.videoDirectory(period), "timelapse.mp4")
+}
 
-	log.Printf("Serving %s", c.RemoteAddr().String())
-	buffer := bufio.NewReader(c)
-	var p = FFMpegProgress{}
-	for {
-		netData, err := buffer.ReadString('\n')
+// usedFramesFilePath lists the frames that went into the video until it is
+// recorded, the images directory may hold more than were used.
+func (g VideoMakerJob) usedFramesFilePath(period string) string {
+	return filepath.Join(g.videoDirectory(period), ".timelapse.frames")
+}
+
+// encode renders the period's images and publishes them as timelapse.mp4.
+// Images are never touched. A forced render skips the coverage threshold.
+func (g VideoMakerJob) encode(ctx context.Context, period string, forced bool) error {
+	frames, err := listFrames(g.imagesDirectory(period))
+	if err != nil {
+		return err
+	}
+	if g.Coverage != nil && !forced {
+		if err = g.checkCoverage(period, frames); err != nil {
+			return err
+		}
+	}
+	if g.BestFrames != nil {
+		frames = selectBestFrames(frames, *g.BestFrames)
+	}
+	usedFrames := frames
+	if g.TitleCards != nil {
+		cardsDirectory, err := os.MkdirTemp("", "title-cards-*")
 		if err != nil {
-			log.Printf("Got EOF or something else while reading from stream: %v", err)
-			return
+			return err
 		}
-		if p.parseLine(netData) {
-			if g.ProgressListener != nil {
-				g.ProgressListener(p)
-			}
-			p = FFMpegProgress{}
+		defer os.RemoveAll(cardsDirectory)
+		if frames, err = g.TitleCards.wrap(frames, cardsDirectory, g.CameraName, period, g.TimelapseType.Profile); err != nil {
+			return errors.New(fmt.Sprintf("creating title cards: %v", err))
 		}
 	}
+	if _, err = encodeAndPublish(ctx, g.encoder(), g.ProgressListener, frames, g.videoFilePath(period), g.TimelapseType.Profile); err != nil {
+		return err
+	}
+	return writeUsedFrames(g.usedFramesFilePath(period), usedFrames)
 }
 
-func (g VideoMakerJob) saveInformationToDatabase(path string) error {
-	parent := filepath.Base(filepath.Dir(path))
-	//Must exists
-	abs, _ := filepath.Abs(path)
-
-	conn, err := g.DBPool.Acquire(context.Background())
+// encodeAndPublish encodes frames into a partial file next to videoFilePath
+// and renames it into place only after it passes verification.
+func encodeAndPublish(ctx context.Context, encoder Encoder, progress func(p FFMpegProgress),
+	frames []string, videoFilePath string, profile *constants.EncodingProfile) (VideoMetadata, error) {
+	targetVideoDirectory := filepath.Dir(videoFilePath)
+	err := os.MkdirAll(targetVideoDirectory, os.ModePerm)
 	if err != nil {
-		log.Printf("Unable to acquire a database connection: %v\n", err)
-		return err
+		return VideoMetadata{}, errors.New(fmt.Sprintf("creating directory %s: %v", targetVideoDirectory, err))
 	}
-	defer conn.Release()
 
-	row := conn.QueryRow(context.Background(),
-		"INSERT INTO \"lig2\".videos (name, type, file_path, uploaded) VALUES ($1, $2, $3, $4) RETURNING id",
-		parent, g.TimelapseType.Name, abs, false)
-	var id uint64
-	err = row.Scan(&id)
+	partialVideoFilePath := filepath.Join(targetVideoDirectory, "."+strings.TrimSuffix(filepath.Base(videoFilePath), ".mp4")+".partial.mp4")
+	log.Printf("Starting to creating video from images to %s", partialVideoFilePath)
+
+	request := EncodeRequest{Frames: frames, OutputPath: partialVideoFilePath, Profile: profile}
+	if err = encoder.Encode(ctx, request, progress); err != nil {
+		removeTemporaryFile(partialVideoFilePath)
+		return VideoMetadata{}, errors.New(fmt.Sprintf("creating video from images: %v", err))
+	}
+
+	metadata, err := encoder.Probe(partialVideoFilePath)
+	if err == nil {
+		err = verifyVideo(metadata, len(frames), profile)
+	}
 	if err != nil {
-		log.Printf("Unable to INSERT: %v", err)
-		return err
+		removeTemporaryFile(partialVideoFilePath)
+		return VideoMetadata{}, errors.New(fmt.Sprintf("verification of %s: %v", partialVideoFilePath, err))
 	}
-	return nil
+
+	if err = os.Rename(partialVideoFilePath, videoFilePath); err != nil {
+		removeTemporaryFile(partialVideoFilePath)
+		return VideoMetadata{}, errors.New(fmt.Sprintf("publishing %s to %s: %v", partialVideoFilePath, videoFilePath, err))
+	}
+	log.Printf("Finished creating video from images to %s (%.1fs, %d frames, %s %dx%d)",
+		videoFilePath, metadata.DurationSeconds, metadata.FrameCount, metadata.Codec, metadata.Width, metadata.Height)
+	return metadata, nil
 }
 
-func (p *FFMpegProgress) parseLine(in string) bool {
-	trimmed := strings.TrimSpace(in)
-	if len(trimmed) == 0 {
-		return false
-	}
-
-	splitValues := strings.Split(trimmed, "=")
-	if len(splitValues) != 2 {
-		return false
-	}
-
-	key := splitValues[0]
-	value := splitValues[1]
-	switch key {
-	case "frame":
-		frameAsInt, _ := strconv.Atoi(value)
-		p.Frame = uint16(frameAsInt)
-		return false
-	case "fps":
-		p.Fps = value
-		return false
-	case "bitrate":
-		if value == "N/A" {
-			p.Bitrate = 0
-		} else {
-			match := bitrateRegex.FindStringSubmatch(value)
-			if len(match[1]) != 0 {
-				float, _ := strconv.ParseFloat(match[1], 16)
-				p.Bitrate = uint32(float * 1000)
-			} else {
-				p.Bitrate = 0
-			}
-		}
-		return false
-	case "total_size":
-		if value == "N/A" {
-			p.TotalSize = 0
+// record stores the published video in the database, reading its metadata
+// back from the file so that a resumed render does not depend on memory.
+func (g VideoMakerJob) record(render *Render) error {
+	videoFilePath := g.videoFilePath(render.Period)
+	metadata, err := g.encoder().Probe(videoFilePath)
+	if err != nil {
+		return errors.New(fmt.Sprintf("probing %s: %v", videoFilePath, err))
+	}
+	usedFrames, err := readUsedFrames(g.usedFramesFilePath(render.Period))
+	if err != nil {
+		log.Printf("Unable to read the frames used for %s, linking all frames of the period: %v", videoFilePath, err)
+	}
+	var coverage *CoverageReport
+	if g.Coverage != nil {
+		frames, _ := listFrames(g.imagesDirectory(render.Period))
+		if report, err := g.Coverage.Report(g.TimelapseType, render.Period, frames); err == nil {
+			coverage = &report
 		} else {
-			parseInt, _ := strconv.ParseInt(value, 10, 32)
-			p.TotalSize = uint32(parseInt)
+			log.Printf("Unable to report coverage of %s: %v", videoFilePath, err)
 		}
-		return false
-	case "out_time_ms":
-		if value[0] == '-' {
-			p.OutTimeMc = 0
-		} else {
-			parseInt, _ := strconv.ParseInt(value, 10, 32)
-			p.OutTimeMc = uint32(parseInt)
+	}
+	videoID, err := g.renders().Record(render, VideoRecord{
+		Type:       g.TimelapseType.Name,
+		Path:       videoFilePath,
+		Metadata:   metadata,
+		Camera:     g.CameraName,
+		UsedFrames: usedFrames,
+		Coverage:   coverage,
+	})
+	if err != nil {
+		return errors.New(fmt.Sprintf("saving info to database: %v", err))
+	}
+	removeTemporaryFile(g.usedFramesFilePath(render.Period))
+	render.advanced(RenderRecorded)
+	render.VideoID = &videoID
+	log.Printf("Saved information about %s in database", videoFilePath)
+	return nil
+}
+
+// archive builds the artifacts of a recorded video from the period's images,
+// keeps a frame of them and removes them. Images that are already gone mean a
+// previous attempt removed them and failed to save the state, so the artifacts
+// and the kept frame it made are left as they are.
+func (g VideoMakerJob) archive(ctx context.Context, render *Render) error {
+	imagesDirectory := g.imagesDirectory(render.Period)
+	if _, err := os.Stat(imagesDirectory); os.IsNotExist(err) {
+		log.Printf("Images of %s render of %s are already removed", g.TimelapseType.Name, render.Period)
+		return g.renders().Advance(render, RenderImagesArchived)
+	}
+	frames, err := listFrames(imagesDirectory)
+	if err != nil {
+		log.Printf("Unable to list frames for artifacts: %v", err)
+	} else {
+		g.createArtifacts(ctx, render, frames)
+	}
+	if g.KeepFrame != nil {
+		if err == nil {
+			err = g.keepFrame(render.Period, frames)
 		}
-		return false
-	case "dup_frames":
-		parseInt, _ := strconv.ParseInt(value, 10, 8)
-		p.DupFrames = uint8(parseInt)
-		return false
-	case "drop_frames":
-		parseInt, _ := strconv.ParseInt(value, 10, 8)
-		p.DropFrames = uint8(parseInt)
-		return false
-	case "speed":
-		p.Speed = value
-		return false
-	case "progress":
-		if value == "continue" {
-			p.Status = Continue
-		} else if value == "end" {
-			p.Status = End
+		if err != nil {
+			return errors.New(fmt.Sprintf("keeping a frame of %s: %v", render.Period, err))
 		}
-		return true
-	default:
-		return false
 	}
+	if err = os.RemoveAll(imagesDirectory); err != nil {
+		return errors.New(fmt.Sprintf("removing images from %s: %v", imagesDirectory, err))
+	}
+	return g.renders().Advance(render, RenderImagesArchived)
+}
+
+// createArtifacts builds the optional by-products of a recorded video from its
+// frames, replacing those of a previous attempt. They are best effort: a
+// failure is logged and does not keep the images from archiving.
+func (g VideoMakerJob) createArtifacts(ctx context.Context, render *Render, frames []string) {
+	if render.VideoID == nil {
+		return
+	}
+	videoID := *render.VideoID
+	if err := g.deleteArtifactsFromDatabase(videoID); err != nil {
+		log.Printf("Unable to clear previous artifacts of video %d: %v", videoID, err)
+		return
+	}
+
+	targetVideoDirectory := g.videoDirectory(render.Period)
+	if g.TimelapseType.SummaryImages {
+		g.createSummaryImages(videoID, frames, targetVideoDirectory)
+	}
+	if g.ContactSheet != nil {
+		g.createContactSheet(videoID, frames, targetVideoDirectory)
+	}
+	if g.Preview != nil {
+		g.createPreview(videoID, frames, targetVideoDirectory)
+	}
+	if g.Hls != nil {
+		g.createHls(ctx, videoID, g.videoFilePath(render.Period), targetVideoDirectory)
+	}
+	if g.Highlights != nil {
+		g.createHighlights(ctx, videoID, frames, targetVideoDirectory)
+	}
+}
+
+func (g VideoMakerJob) deleteArtifactsFromDatabase(videoID uint64) error {
+	return g.renders().DeleteArtifacts(videoID)
 }
 
-func createFrameOrderFile(imagesToCollectDirectory string) (string, error) {
+func (g VideoMakerJob) saveArtifactToDatabase(videoID uint64, kind string, path string) error {
+	return g.renders().SaveArtifact(videoID, kind, path)
+}
+
+func removeTemporaryFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error while removing %s: %v", path, err)
+	}
+}
+
+func listFrames(imagesToCollectDirectory string) ([]string, error) {
 	dir, err := os.ReadDir(imagesToCollectDirectory)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if len(dir) == 0 {
-		return "", errors.New(fmt.Sprintf("No files found at %s. Exiting", imagesToCollectDirectory))
+		return nil, errors.New(fmt.Sprintf("No files found at %s. Exiting", imagesToCollectDirectory))
 	}
 
 	sort.SliceStable(dir, func(i, j int) bool {
-		file1, _ := time.Parse("02-01-2006 15_04_05.jpg", dir[i].Name())
-		file2, _ := time.Parse("02-01-2006 15_04_05.jpg", dir[j].Name())
+		file1, _ := time.Parse(FrameNameLayout, dir[i].Name())
+		file2, _ := time.Parse(FrameNameLayout, dir[j].Name())
 		return file1.Before(file2)
 	})
 
-	temp, err := os.CreateTemp("", "*.txt")
-	if err != nil {
-		return "", err
-	}
-	defer temp.Close()
-
-	writer := bufio.NewWriter(temp)
-	defer writer.Flush()
 	abs, _ := filepath.Abs(imagesToCollectDirectory)
+	frames := make([]string, 0, len(dir))
 	for _, data := range dir {
-		_, _ = writer.WriteString(fmt.Sprintf("file '%s'\n", filepath.Join(abs, data.Name())))
-		_, _ = writer.WriteString("duration 0.2\n")
+		frames = append(frames, filepath.Join(abs, data.Name()))
+	}
+	return frames, nil
+}
+
+func sampleFrames(frames []string, n int) []string {
+	if n <= 0 || len(frames) <= n {
+		return frames
 	}
+	if n == 1 {
+		return []string{frames[len(frames)/2]}
+	}
+	sampled := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		sampled = append(sampled, frames[i*(len(frames)-1)/(n-1)])
+	}
+	return sampled
+}
 
-	return temp.Name(), nil
+func frameCaptureTime(frame string) (time.Time, error) {
+	return time.ParseInLocation(FrameNameLayout, filepath.Base(frame), time.Local)
 }
@@ -0,0 +1,333 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"timelapse_maker/constants"
+)
+
+// memoryRenders is a RenderRepository that keeps everything in memory.
+type memoryRenders struct {
+	mutex   sync.Mutex
+	renders map[string]Render
+	claimed map[string]bool
+	videos  []VideoRecord
+	nextID  uint64
+	cleared []uint64 //videos whose artifacts were deleted
+}
+
+func newMemoryRenders() *memoryRenders {
+	return &memoryRenders{renders: map[string]Render{}, claimed: map[string]bool{}}
+}
+
+func (m *memoryRenders) save(render Render) {
+	m.renders[render.Type+"/"+render.Period] = render
+}
+
+func (m *memoryRenders) Create(timelapseType string, period string) (Render, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := timelapseType + "/" + period
+	if _, ok := m.renders[key]; !ok {
+		m.nextID++
+		m.renders[key] = Render{ID: m.nextID, Type: timelapseType, Period: period, State: RenderPending}
+	}
+	return m.renders[key], nil
+}
+
+func (m *memoryRenders) Get(timelapseType string, period string) (Render, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	render, ok := m.renders[timelapseType+"/"+period]
+	if !ok {
+		return Render{}, ErrRenderNotFound
+	}
+	return render, nil
+}
+
+func (m *memoryRenders) Claim(timelapseType string, period string, lease time.Duration) (Render, bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := timelapseType + "/" + period
+	render, ok := m.renders[key]
+	if !ok || m.claimed[key] {
+		return Render{}, false, nil
+	}
+	m.claimed[key] = true
+	return render, true, nil
+}
+
+func (m *memoryRenders) Release(render *Render) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.claimed, render.Type+"/"+render.Period)
+	return nil
+}
+
+func (m *memoryRenders) Advance(render *Render, state RenderState) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	render.advanced(state)
+	m.save(*render)
+	return nil
+}
+
+func (m *memoryRenders) Fail(render *Render, reason error, backoff RenderBackoff) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	render.FailedState = render.resumeState()
+	render.State = RenderFailed
+	render.Reason = reason.Error()
+	render.Attempts++
+	m.save(*render)
+	return nil
+}
+
+func (m *memoryRenders) Block(render *Render, reason error) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	render.FailedState = render.resumeState()
+	render.State = RenderBlocked
+	render.Reason = reason.Error()
+	m.save(*render)
+	return nil
+}
+
+func (m *memoryRenders) Force(render *Render) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if render.State == RenderBlocked {
+		render.State = RenderFailed
+	}
+	render.Forced = true
+	render.Attempts = 0
+	m.save(*render)
+	return nil
+}
+
+func (m *memoryRenders) Record(render *Render, video VideoRecord) (uint64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.videos = append(m.videos, video)
+	videoID := uint64(len(m.videos))
+	recorded := *render
+	recorded.advanced(RenderRecorded)
+	recorded.VideoID = &videoID
+	m.save(recorded)
+	return videoID, nil
+}
+
+func (m *memoryRenders) DeleteArtifacts(videoID uint64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.cleared = append(m.cleared, videoID)
+	return nil
+}
+
+func (m *memoryRenders) SaveArtifact(videoID uint64, kind string, path string) error { return nil }
+
+func (m *memoryRenders) SaveHighlight(videoID uint64, path string, startsAt time.Time, endsAt time.Time, score float64) error {
+	return nil
+}
+
+// testType has no image based artifacts, so frames do not need to be images.
+var testType = constants.TimelapseType{
+	Name:      "TEST",
+	Directory: "tests",
+	SubDirectoryNaming: func(t time.Time) string {
+		return t.Format("2006-01-02")
+	},
+	PeriodBounds: func(name string) (time.Time, time.Time, error) {
+		start, err := time.ParseInLocation("2006-01-02", name, time.Local)
+		return start, start.AddDate(0, 0, 1), err
+	},
+	MaxRenderDuration: time.Minute,
+	Profile:           &constants.DefaultProfile,
+}
+
+const testPeriod = "2026-10-17"
+
+func newTestJob(t *testing.T, encoder *FakeEncoder, frameCount int) (VideoMakerJob, *memoryRenders) {
+	root := t.TempDir()
+	job := VideoMakerJob{
+		Context:             context.Background(),
+		CameraName:          "test",
+		RootDirectory:       filepath.Join(root, "videos"),
+		ImagesRootDirectory: filepath.Join(root, "images"),
+		TimelapseType:       &testType,
+		ProgressListener:    func(p FFMpegProgress) {},
+		Encoder:             encoder,
+	}
+	imagesDirectory := job.imagesDirectory(testPeriod)
+	if err := os.MkdirAll(imagesDirectory, 0770); err != nil {
+		t.Fatal(err)
+	}
+	start, _, _ := testType.PeriodBounds(testPeriod)
+	for i := 0; i < frameCount; i++ {
+		name := start.Add(8*time.Hour + time.Duration(i)*2*time.Minute).Format(FrameNameLayout)
+		if err := os.WriteFile(filepath.Join(imagesDirectory, name), []byte("frame"), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+	renders := newMemoryRenders()
+	job.Renders = renders
+	return job, renders
+}
+
+func assertNoPartialFiles(t *testing.T, job VideoMakerJob) {
+	t.Helper()
+	partials, _ := filepath.Glob(filepath.Join(job.videoDirectory(testPeriod), ".*.partial.mp4"))
+	if len(partials) > 0 {
+		t.Errorf("partial files left behind: %v", partials)
+	}
+}
+
+func TestResumeRecordsVideoAndRemovesImages(t *testing.T) {
+	job, renders := newTestJob(t, &FakeEncoder{}, 5)
+
+	job.Render(testPeriod)
+
+	render, _ := renders.Get(testType.Name, testPeriod)
+	if render.State != RenderImagesArchived {
+		t.Fatalf("render state is %s (%s), expected %s", render.State, render.Reason, RenderImagesArchived)
+	}
+	if _, err := os.Stat(job.videoFilePath(testPeriod)); err != nil {
+		t.Errorf("video was not published: %v", err)
+	}
+	if _, err := os.Stat(job.imagesDirectory(testPeriod)); !os.IsNotExist(err) {
+		t.Errorf("images were not removed: %v", err)
+	}
+	if len(renders.videos) != 1 {
+		t.Fatalf("%d videos recorded, expected 1", len(renders.videos))
+	}
+	video := renders.videos[0]
+	if video.Type != testType.Name || video.Metadata.FrameCount != 5 || len(video.UsedFrames) != 5 {
+		t.Errorf("unexpected video record %+v", video)
+	}
+	if render.VideoID == nil || *render.VideoID != 1 {
+		t.Errorf("render is not linked to the video: %v", render.VideoID)
+	}
+	assertNoPartialFiles(t, job)
+}
+
+func TestResumeKeepsImagesWhenEncodeFails(t *testing.T) {
+	job, renders := newTestJob(t, &FakeEncoder{Err: errors.New("encoder crashed")}, 5)
+
+	job.Render(testPeriod)
+
+	render, _ := renders.Get(testType.Name, testPeriod)
+	if render.State != RenderFailed || render.FailedState != RenderEncoding {
+		t.Errorf("render is %s at %s, expected %s at %s", render.State, render.FailedState, RenderFailed, RenderEncoding)
+	}
+	if frames, err := listFrames(job.imagesDirectory(testPeriod)); err != nil || len(frames) != 5 {
+		t.Errorf("images were not kept: %d frames, %v", len(frames), err)
+	}
+	if _, err := os.Stat(job.videoFilePath(testPeriod)); !os.IsNotExist(err) {
+		t.Errorf("video was published although the encode failed: %v", err)
+	}
+	if len(renders.videos) != 0 {
+		t.Errorf("%d videos recorded, expected none", len(renders.videos))
+	}
+	assertNoPartialFiles(t, job)
+}
+
+func TestResumeKeepsImagesWhenCancelled(t *testing.T) {
+	job, renders := newTestJob(t, &FakeEncoder{FrameDelay: 50 * time.Millisecond}, 20)
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+	job.Context = ctx
+
+	job.Render(testPeriod)
+
+	render, _ := renders.Get(testType.Name, testPeriod)
+	if render.State != RenderFailed || render.FailedState != RenderEncoding {
+		t.Errorf("render is %s at %s, expected %s at %s", render.State, render.FailedState, RenderFailed, RenderEncoding)
+	}
+	if frames, err := listFrames(job.imagesDirectory(testPeriod)); err != nil || len(frames) != 20 {
+		t.Errorf("images were not kept: %d frames, %v", len(frames), err)
+	}
+	if _, err := os.Stat(job.videoFilePath(testPeriod)); !os.IsNotExist(err) {
+		t.Errorf("video was published although the encode was cancelled: %v", err)
+	}
+	assertNoPartialFiles(t, job)
+}
+
+func TestResumeContinuesFromEncodedState(t *testing.T) {
+	job, renders := newTestJob(t, &FakeEncoder{}, 3)
+	frames, _ := listFrames(job.imagesDirectory(testPeriod))
+	// a previous process published the video and stopped before recording it
+	if _, err := encodeAndPublish(context.Background(), &FakeEncoder{}, nil, frames, job.videoFilePath(testPeriod), testType.Profile); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeUsedFrames(job.usedFramesFilePath(testPeriod), frames[1:]); err != nil {
+		t.Fatal(err)
+	}
+	render, _ := renders.Create(testType.Name, testPeriod)
+	render.State = RenderEncoded
+	renders.save(render)
+	job.Encoder = &FakeEncoder{Err: errors.New("the published video must not be encoded again")}
+
+	job.Resume(testPeriod)
+
+	render, _ = renders.Get(testType.Name, testPeriod)
+	if render.State != RenderImagesArchived {
+		t.Fatalf("render state is %s (%s), expected %s", render.State, render.Reason, RenderImagesArchived)
+	}
+	if len(renders.videos) != 1 {
+		t.Fatalf("%d videos recorded, expected 1", len(renders.videos))
+	}
+	if video := renders.videos[0]; video.Metadata.FrameCount != 3 || len(video.UsedFrames) != 2 {
+		t.Errorf("video recorded with %d frames and %d used frames, expected 3 and 2", video.Metadata.FrameCount, len(video.UsedFrames))
+	}
+	if _, err := os.Stat(job.usedFramesFilePath(testPeriod)); !os.IsNotExist(err) {
+		t.Errorf("used frames file was not removed: %v", err)
+	}
+}
+
+func TestResumeLeavesClaimedRenderAlone(t *testing.T) {
+	job, renders := newTestJob(t, &FakeEncoder{}, 3)
+	render, _ := renders.Create(testType.Name, testPeriod)
+	if _, ok, _ := renders.Claim(testType.Name, testPeriod, time.Minute); !ok {
+		t.Fatal("unable to claim the render")
+	}
+
+	job.Resume(testPeriod)
+
+	if current, _ := renders.Get(testType.Name, testPeriod); current.State != render.State {
+		t.Errorf("claimed render moved from %s to %s", render.State, current.State)
+	}
+	if _, err := os.Stat(job.videoFilePath(testPeriod)); !os.IsNotExist(err) {
+		t.Errorf("claimed render was encoded: %v", err)
+	}
+	if frames, err := listFrames(job.imagesDirectory(testPeriod)); err != nil || len(frames) != 3 {
+		t.Errorf("images of the claimed render were touched: %d frames, %v", len(frames), err)
+	}
+}
+
+func TestResumeArchivesWhenImagesAreAlreadyRemoved(t *testing.T) {
+	job, renders := newTestJob(t, &FakeEncoder{}, 3)
+	job.KeepFrame = &KeepFrameSettings{TimeOfDay: 12 * time.Hour}
+	videoID := uint64(7)
+	render, _ := renders.Create(testType.Name, testPeriod)
+	render.State = RenderRecorded
+	render.VideoID = &videoID
+	renders.save(render)
+	if err := os.RemoveAll(job.imagesDirectory(testPeriod)); err != nil {
+		t.Fatal(err)
+	}
+
+	job.Resume(testPeriod)
+
+	render, _ = renders.Get(testType.Name, testPeriod)
+	if render.State != RenderImagesArchived {
+		t.Errorf("render state is %s (%s), expected %s", render.State, render.Reason, RenderImagesArchived)
+	}
+	if len(renders.cleared) != 0 {
+		t.Errorf("artifacts of videos %v were deleted", renders.cleared)
+	}
+}
@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// VideoRecord is the video row written when a render is recorded, together
+// with what is linked to it.
+type VideoRecord struct {
+	Type       string
+	Path       string
+	Metadata   VideoMetadata
+	Camera     string
+	UsedFrames []string //nil links all frames of the render's period
+	Coverage   *CoverageReport
+}
+
+// RenderRepository persists renders and the videos they produce. RenderStore
+// keeps them in Postgres.
+type RenderRepository interface {
+	Create(timelapseType string, period string) (Render, error)
+	Get(timelapseType string, period string) (Render, error)
+	// Claim takes the render for this process for lease, across processes;
+	// ok is false while another claim on it is running.
+	Claim(timelapseType string, period string, lease time.Duration) (render Render, ok bool, err error)
+	Release(render *Render) error
+	Advance(render *Render, state RenderState) error
+	Fail(render *Render, reason error, backoff RenderBackoff) error
+	Block(render *Render, reason error) error
+	Force(render *Render) error
+	// Record inserts the video and moves the render to recorded atomically. The
+	// caller marks the render advanced once it returns without error.
+	Record(render *Render, video VideoRecord) (uint64, error)
+	DeleteArtifacts(videoID uint64) error
+	SaveArtifact(videoID uint64, kind string, path string) error
+	SaveHighlight(videoID uint64, path string, startsAt time.Time, endsAt time.Time, score float64) error
+}
+
+func (s RenderStore) Record(render *Render, video VideoRecord) (uint64, error) {
+	parent := filepath.Base(filepath.Dir(video.Path))
+	//Must exists
+	abs, _ := filepath.Abs(video.Path)
+
+	tx, err := s.DBPool.Begin(context.Background())
+	if err != nil {
+		log.Printf("Unable to begin a database transaction: %v\n", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	metadata := video.Metadata
+	row := tx.QueryRow(context.Background(),
+		"INSERT INTO \"lig2\".videos (name, type, file_path, uploaded, duration_seconds, frame_count, codec, width, height) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id",
+		parent, video.Type, abs, false,
+		metadata.DurationSeconds, metadata.FrameCount, metadata.Codec, metadata.Width, metadata.Height)
+	var id uint64
+	err = row.Scan(&id)
+	if err != nil {
+		log.Printf("Unable to INSERT: %v", err)
+		return 0, err
+	}
+	if err = linkFramesTx(tx, id, video.Camera, video.Type, render.Period, video.UsedFrames); err != nil {
+		log.Printf("Unable to link frames: %v", err)
+		return 0, err
+	}
+	if video.Coverage != nil {
+		if err = saveCoverageTx(tx, id, *video.Coverage); err != nil {
+			log.Printf("Unable to save coverage report: %v", err)
+			return 0, err
+		}
+	}
+	if err = s.AdvanceTx(tx, render, RenderRecorded, id); err != nil {
+		log.Printf("Unable to UPDATE render: %v", err)
+		return 0, err
+	}
+	return id, tx.Commit(context.Background())
+}
+
+func (s RenderStore) DeleteArtifacts(videoID uint64) error {
+	_, err := s.DBPool.Exec(context.Background(),
+		"DELETE FROM \"lig2\".video_artifacts WHERE video_id = $1", videoID)
+	if err != nil {
+		return err
+	}
+	_, err = s.DBPool.Exec(context.Background(),
+		"DELETE FROM \"lig2\".highlights WHERE video_id = $1", videoID)
+	return err
+}
+
+func (s RenderStore) SaveArtifact(videoID uint64, kind string, path string) error {
+	abs, _ := filepath.Abs(path)
+
+	conn, err := s.DBPool.Acquire(context.Background())
+	if err != nil {
+		log.Printf("Unable to acquire a database connection: %v\n", err)
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(context.Background(),
+		"INSERT INTO \"lig2\".video_artifacts (video_id, kind, file_path) VALUES ($1, $2, $3)",
+		videoID, kind, abs)
+	if err != nil {
+		log.Printf("Unable to INSERT: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s RenderStore) SaveHighlight(videoID uint64, path string, startsAt time.Time, endsAt time.Time, score float64) error {
+	abs, _ := filepath.Abs(path)
+	_, err := s.DBPool.Exec(context.Background(),
+		"INSERT INTO \"lig2\".highlights (video_id, file_path, starts_at, ends_at, score) VALUES ($1, $2, $3, $4, $5)",
+		videoID, abs, startsAt, endsAt, score)
+	return err
+}
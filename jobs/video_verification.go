@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"math"
+	"strconv"
+	"time"
+	"timelapse_maker/constants"
+)
+
+const (
+	probeTimeout            = time.Minute
+	frameCountTolerance     = 2
+	durationToleranceFrames = 2
+)
+
+type VideoMetadata struct {
+	DurationSeconds float64
+	FrameCount      int64
+	Codec           string
+	Width           int
+	Height          int
+}
+
+type probeOutput struct {
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+		NbFrames  string `json:"nb_frames"`
+		Duration  string `json:"duration"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+func probeVideo(path string) (VideoMetadata, error) {
+	output, err := ffmpeg.ProbeWithTimeout(path, probeTimeout, nil)
+	if err != nil {
+		return VideoMetadata{}, err
+	}
+	var probe probeOutput
+	if err = json.Unmarshal([]byte(output), &probe); err != nil {
+		return VideoMetadata{}, err
+	}
+
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "video" {
+			continue
+		}
+		metadata := VideoMetadata{Codec: stream.CodecName, Width: stream.Width, Height: stream.Height}
+		metadata.FrameCount, _ = strconv.ParseInt(stream.NbFrames, 10, 64)
+		duration := stream.Duration
+		if duration == "" {
+			duration = probe.Format.Duration
+		}
+		metadata.DurationSeconds, _ = strconv.ParseFloat(duration, 64)
+		return metadata, nil
+	}
+	return VideoMetadata{}, errors.New(fmt.Sprintf("no video stream in %s", path))
+}
+
+// verifyVideo checks the encoded file against what the frame list and the
+// encoding profile promise. The concat demuxer may drop or repeat the boundary
+// frames, so counts are compared with a small tolerance.
+func verifyVideo(metadata VideoMetadata, expectedFrames int, profile *constants.EncodingProfile) error {
+	if metadata.Codec != profile.CodecName {
+		return errors.New(fmt.Sprintf("codec is %s, expected %s", metadata.Codec, profile.CodecName))
+	}
+	if metadata.Width != profile.Width || metadata.Height != profile.Height {
+		return errors.New(fmt.Sprintf("resolution is %dx%d, expected %dx%d",
+			metadata.Width, metadata.Height, profile.Width, profile.Height))
+	}
+	if math.Abs(float64(metadata.FrameCount-int64(expectedFrames))) > frameCountTolerance {
+		return errors.New(fmt.Sprintf("frame count is %d, expected %d", metadata.FrameCount, expectedFrames))
+	}
+	expectedDuration := float64(expectedFrames) / float64(profile.Framerate)
+	if math.Abs(metadata.DurationSeconds-expectedDuration) > durationToleranceFrames/float64(profile.Framerate) {
+		return errors.New(fmt.Sprintf("duration is %.2fs, expected %.2fs", metadata.DurationSeconds, expectedDuration))
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+	"timelapse_maker/constants"
+)
+
+const representativeHour = 12
+
+// YearCompilationJob renders constants.Year from one representative frame per
+// day: the frame nearest noon while the day's images or kept frames are still
+// retained, or the middle frame of that day's video otherwise.
+type YearCompilationJob struct {
+	Context             context.Context
+	RootDirectory       string
+	ImagesRootDirectory string
+	DBPool              *pgxpool.Pool
+	Encoder             Encoder
+	ProgressListener    func(p FFMpegProgress)
+	Limits              FfmpegLimits
+	Queue               *RenderQueue
+}
+
+type yearDay struct {
+	Day    string
+	Frame  string
+	Source string //"image" or "video"
+}
+
+func (g YearCompilationJob) Run() {
+	year := constants.Year.SubDirectoryNaming(time.Now())
+	if g.Queue == nil {
+		g.Compile(year)
+		return
+	}
+	g.Queue.Submit(&constants.Year, year, func() {
+		g.Compile(year)
+	})
+}
+
+func (g YearCompilationJob) Compile(year string) {
+	ctx, cancel := context.WithTimeout(g.Context, constants.Year.MaxRenderDuration)
+	defer cancel()
+
+	extractDirectory, err := os.MkdirTemp("", "year-frames-*")
+	if err != nil {
+		log.Printf("Unable to create directory for extracted frames: %v", err)
+		return
+	}
+	defer os.RemoveAll(extractDirectory)
+
+	days, err := g.collectDays(ctx, year, extractDirectory)
+	if err != nil {
+		log.Printf("Unable to collect days of %s: %v", year, err)
+		return
+	}
+	if len(days) == 0 {
+		log.Printf("No days found for %s compilation", year)
+		return
+	}
+
+	frames := make([]string, len(days))
+	for i, day := range days {
+		frames[i] = day.Frame
+	}
+	videoFilePath := filepath.Join(g.RootDirectory, constants.Year.Directory, year, "timelapse.mp4")
+	metadata, err := encodeAndPublish(ctx, g.Encoder, g.ProgressListener, frames, videoFilePath, constants.Year.Profile)
+	if err != nil {
+		log.Printf("Unable to compile %s: %v", year, err)
+		return
+	}
+	if err = g.saveInformationToDatabase(videoFilePath, metadata, days); err != nil {
+		log.Printf("Error while saving info about %s to database: %v", videoFilePath, err)
+		return
+	}
+	log.Printf("Compiled %s from %d days into %s", year, len(days), videoFilePath)
+}
+
+func (g YearCompilationJob) collectDays(ctx context.Context, year string, extractDirectory string) ([]yearDay, error) {
+	start, end, err := constants.Year.PeriodBounds(year)
+	if err != nil {
+		return nil, err
+	}
+	var days []yearDay
+	for date := start; date.Before(end) && date.Before(time.Now()); date = date.AddDate(0, 0, 1) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		day := constants.Day.SubDirectoryNaming(date)
+		noon := time.Date(date.Year(), date.Month(), date.Day(), representativeHour, 0, 0, 0, time.Local)
+
+		if frame, ok := g.imageNear(day, noon); ok {
+			days = append(days, yearDay{Day: day, Frame: frame, Source: "image"})
+			continue
+		}
+
+		videoFilePath := filepath.Join(g.RootDirectory, constants.Day.Directory, day, "timelapse.mp4")
+		if _, err := os.Stat(videoFilePath); err != nil {
+			continue
+		}
+		framePath := filepath.Join(extractDirectory, noon.Format(FrameNameLayout))
+		if err := g.extractMiddleFrame(ctx, videoFilePath, framePath); err != nil {
+			log.Printf("Skipping %s in year compilation: %v", day, err)
+			continue
+		}
+		days = append(days, yearDay{Day: day, Frame: framePath, Source: "video"})
+	}
+	return days, nil
+}
+
+// imageNear looks for the frame nearest to t among the day's images and, once
+// those are removed, its kept frames.
+func (g YearCompilationJob) imageNear(day string, t time.Time) (string, bool) {
+	for _, directory := range []string{
+		filepath.Join(g.ImagesRootDirectory, constants.Day.Directory, day),
+		keptFramesDirectory(g.ImagesRootDirectory, day),
+	} {
+		if frames, err := listFrames(directory); err == nil {
+			if frame, _, ok := nearestFrame(frames, t); ok {
+				return frame, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (g YearCompilationJob) extractMiddleFrame(ctx context.Context, videoFilePath string, framePath string) error {
+	metadata, err := g.Encoder.Probe(videoFilePath)
+	if err != nil {
+		return err
+	}
+	stream := ffmpeg.Input(videoFilePath, ffmpeg.KwArgs{"ss": fmt.Sprintf("%.3f", metadata.DurationSeconds/2)}).
+		Output(framePath, ffmpeg.KwArgs{"frames:v": 1, "q:v": 2}).
+		OverWriteOutput()
+	return runFfmpeg(ctx, stream, g.Limits)
+}
+
+func (g YearCompilationJob) saveInformationToDatabase(path string, metadata VideoMetadata, days []yearDay) error {
+	abs, _ := filepath.Abs(path)
+
+	tx, err := g.DBPool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	var id uint64
+	err = tx.QueryRow(context.Background(),
+		"INSERT INTO \"lig2\".videos (name, type, file_path, uploaded, duration_seconds, frame_count, codec, width, height) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id",
+		filepath.Base(filepath.Dir(path)), constants.Year.Name, abs, false,
+		metadata.DurationSeconds, metadata.FrameCount, metadata.Codec, metadata.Width, metadata.Height).Scan(&id)
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		_, err = tx.Exec(context.Background(),
+			"INSERT INTO \"lig2\".video_sources (video_id, day, source) VALUES ($1, $2, $3)",
+			id, day.Day, day.Source)
+		if err != nil {
+			return errors.New(fmt.Sprintf("recording day %s: %v", day.Day, err))
+		}
+	}
+	return tx.Commit(context.Background())
+}
@@ -5,46 +5,84 @@ import (
 	"fmt"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 	"timelapse_maker/constants"
 	"timelapse_maker/cron"
+	"timelapse_maker/imaging"
 	"timelapse_maker/jobs"
 	"timelapse_maker/utils"
 )
 
 var (
+	shutdownContext, shutdown = context.WithCancel(context.Background())
+
 	propertyManager     = &utils.PropertyManager{}
 	imageDownloader     = &utils.ImageDownloader{Url: propertyManager.GetProperty(constants.ImageUrl)}
 	dbPool              = initDataBasePool(propertyManager.GetProperty(constants.DBUrl))
 	baseDirectory       = propertyManager.GetProperty(constants.BaseDirectory)
 	imagesBaseDirectory = filepath.Join(baseDirectory, "images")
+	frameStore          = &jobs.FrameStore{DBPool: dbPool}
 
-	downloadJobs = [4]struct {
+	schedulerLocation, _ = time.LoadLocation("Europe/Moscow")
+	downloadSchedules    = [4]struct {
 		string
-		jobs.ImageDownloadJob
+		*constants.TimelapseType
 	}{
-		{"0 */2 8-20 ? * *", jobs.ImageDownloadJob{RootDirectory: imagesBaseDirectory, TimelapseType: &constants.Day, ImageDownloader: imageDownloader}},
-		{"0 */15 8-20 ? * *", jobs.ImageDownloadJob{RootDirectory: imagesBaseDirectory, TimelapseType: &constants.Week, ImageDownloader: imageDownloader}},
-		{"0 0 8-20 ? * *", jobs.ImageDownloadJob{RootDirectory: imagesBaseDirectory, TimelapseType: &constants.Month, ImageDownloader: imageDownloader}},
-		{"0 0 8,12,16,20 * * ?", jobs.ImageDownloadJob{RootDirectory: imagesBaseDirectory, TimelapseType: &constants.Quarter, ImageDownloader: imageDownloader}},
+		{"0 */2 8-20 ? * *", &constants.Day},
+		{"0 */15 8-20 ? * *", &constants.Week},
+		{"0 0 8-20 ? * *", &constants.Month},
+		{"0 0 8,12,16,20 * * ?", &constants.Quarter},
 	}
+	mainCamera   = jobs.Camera{Name: propertyManager.GetStringProperty(constants.CameraName, "main"), ImagesRootDirectory: imagesBaseDirectory}
+	extraCameras = initExtraCameras()
 
 	loggingProgressListener = func(p jobs.FFMpegProgress) {
-		log.Printf("Frame:%d; Fps:%s; Size:%s; Time Passed: %s; Status: %s", p.Frame, p.Fps, byteCountSI(p.TotalSize), (time.Duration(p.OutTimeMc) * time.Microsecond).String(), p.Status.Name)
+		log.Printf("Frame:%d/%d (%.1f%%); Fps:%s; Speed:%s; Size:%s; Elapsed: %s; ETA: %s; Status: %s", p.Frame, p.TotalFrames, p.Percent, p.Fps, p.Speed, byteCountSI(p.TotalSize), p.Elapsed.Round(time.Second), p.ETA.Round(time.Second), p.Status.Name)
+	}
+	previewSettings = &jobs.PreviewSettings{
+		Frames:   propertyManager.GetIntProperty(constants.PreviewFrames, 100),
+		Width:    propertyManager.GetIntProperty(constants.PreviewWidth, 320),
+		Delay:    propertyManager.GetIntProperty(constants.PreviewDelay, 10),
+		MaxBytes: propertyManager.GetIntProperty(constants.PreviewMaxBytes, 8000000),
+	}
+	hlsSettings   = initHlsSettings()
+	renderBackoff = jobs.RenderBackoff{
+		Initial:     propertyManager.GetDurationProperty(constants.RenderRetryInitialDelay, time.Minute),
+		Max:         propertyManager.GetDurationProperty(constants.RenderRetryMaxDelay, 6*time.Hour),
+		MaxAttempts: propertyManager.GetIntProperty(constants.RenderRetryMaxAttempts, 8),
+	}
+	renderQueue  = jobs.NewRenderQueue(shutdownContext, propertyManager.GetIntProperty(constants.RenderWorkers, 1))
+	renderLimits = jobs.FfmpegLimits{
+		Nice:    propertyManager.GetIntProperty(constants.RenderNice, 10),
+		Threads: propertyManager.GetIntProperty(constants.RenderThreads, 0),
 	}
 	videosBaseDirectory = filepath.Join(baseDirectory, "videos")
-	videoJobs           = [4]struct {
+	seasonComparisonJob = initSeasonComparisonJob()
+	// mosaics run before the video jobs of the same type archive the main camera's images
+	mosaicSchedules = [4]struct {
+		string
+		*constants.TimelapseType
+	}{
+		{"0 0 22 ? * *", &constants.Day},
+		{"0 55 21 ? * SUN", &constants.Week},
+		{"0 50 21 L * ?", &constants.Month},
+		{"0 45 21 L MAR,JUN,SEP,DEC ?", &constants.Quarter},
+	}
+	yearCompilationJob = jobs.YearCompilationJob{Context: shutdownContext, RootDirectory: videosBaseDirectory, ImagesRootDirectory: imagesBaseDirectory, DBPool: dbPool, Encoder: encoderFor(&constants.Year), ProgressListener: loggingProgressListener, Limits: renderLimits, Queue: renderQueue}
+	videoJobs          = [4]struct {
 		string
 		jobs.VideoMakerJob
 	}{
-		{"0 20 22 ? * *", jobs.VideoMakerJob{RootDirectory: videosBaseDirectory, ImagesRootDirectory: imagesBaseDirectory, TimelapseType: &constants.Day, DBPool: dbPool, ProgressListener: loggingProgressListener}},
-		{"0 15 22 ? * SUN", jobs.VideoMakerJob{RootDirectory: videosBaseDirectory, ImagesRootDirectory: imagesBaseDirectory, TimelapseType: &constants.Week, DBPool: dbPool, ProgressListener: loggingProgressListener}},
-		{"0 10 22 L * ?", jobs.VideoMakerJob{RootDirectory: videosBaseDirectory, ImagesRootDirectory: imagesBaseDirectory, TimelapseType: &constants.Month, DBPool: dbPool, ProgressListener: loggingProgressListener}},
-		{"0 5 22 L MAR,JUN,SEP,DEC ?", jobs.VideoMakerJob{RootDirectory: videosBaseDirectory, ImagesRootDirectory: imagesBaseDirectory, TimelapseType: &constants.Quarter, DBPool: dbPool, ProgressListener: loggingProgressListener}},
+		{"0 20 22 ? * *", jobs.VideoMakerJob{Context: shutdownContext, CameraName: mainCamera.Name, RootDirectory: videosBaseDirectory, ImagesRootDirectory: imagesBaseDirectory, TimelapseType: &constants.Day, DBPool: dbPool, ProgressListener: loggingProgressListener, Preview: previewSettings, ContactSheet: contactSheetFor(&constants.Day), Hls: hlsFor(&constants.Day), Backoff: renderBackoff, Queue: renderQueue, Limits: renderLimits, Encoder: encoderFor(&constants.Day), TitleCards: titleCardsFor(&constants.Day), Highlights: highlightsFor(&constants.Day), BestFrames: bestFramesFor(&constants.Day), Coverage: coverageFor(&constants.Day), KeepFrame: &jobs.KeepFrameSettings{TimeOfDay: seasonComparisonJob.TimeOfDay}}},
+		{"0 15 22 ? * SUN", jobs.VideoMakerJob{Context: shutdownContext, CameraName: mainCamera.Name, RootDirectory: videosBaseDirectory, ImagesRootDirectory: imagesBaseDirectory, TimelapseType: &constants.Week, DBPool: dbPool, ProgressListener: loggingProgressListener, Preview: previewSettings, ContactSheet: contactSheetFor(&constants.Week), Hls: hlsFor(&constants.Week), Backoff: renderBackoff, Queue: renderQueue, Limits: renderLimits, Encoder: encoderFor(&constants.Week), TitleCards: titleCardsFor(&constants.Week), Highlights: highlightsFor(&constants.Week), BestFrames: bestFramesFor(&constants.Week), Coverage: coverageFor(&constants.Week)}},
+		{"0 10 22 L * ?", jobs.VideoMakerJob{Context: shutdownContext, CameraName: mainCamera.Name, RootDirectory: videosBaseDirectory, ImagesRootDirectory: imagesBaseDirectory, TimelapseType: &constants.Month, DBPool: dbPool, ProgressListener: loggingProgressListener, Preview: previewSettings, ContactSheet: contactSheetFor(&constants.Month), Hls: hlsFor(&constants.Month), Backoff: renderBackoff, Queue: renderQueue, Limits: renderLimits, Encoder: encoderFor(&constants.Month), TitleCards: titleCardsFor(&constants.Month), Highlights: highlightsFor(&constants.Month), BestFrames: bestFramesFor(&constants.Month), Coverage: coverageFor(&constants.Month)}},
+		{"0 5 22 L MAR,JUN,SEP,DEC ?", jobs.VideoMakerJob{Context: shutdownContext, CameraName: mainCamera.Name, RootDirectory: videosBaseDirectory, ImagesRootDirectory: imagesBaseDirectory, TimelapseType: &constants.Quarter, DBPool: dbPool, ProgressListener: loggingProgressListener, Preview: previewSettings, ContactSheet: contactSheetFor(&constants.Quarter), Hls: hlsFor(&constants.Quarter), Backoff: renderBackoff, Queue: renderQueue, Limits: renderLimits, Encoder: encoderFor(&constants.Quarter), TitleCards: titleCardsFor(&constants.Quarter), Highlights: highlightsFor(&constants.Quarter), BestFrames: bestFramesFor(&constants.Quarter), Coverage: coverageFor(&constants.Quarter)}},
 	}
 )
 
@@ -56,32 +94,111 @@ func main() {
 
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
 
-	location, _ := time.LoadLocation("Europe/Moscow")
+	for _, profile := range constants.EncodingProfiles {
+		configureProfile(profile)
+	}
 
-	c := cron.New(cron.WithLocation(location), cron.WithSeconds())
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
 
-	for _, element := range downloadJobs {
-		_, err := c.AddJob(element.string, element.ImageDownloadJob)
-		if err != nil {
-			log.Fatal(fmt.Sprintf("%s image job not created due to %s", element.ImageDownloadJob.TimelapseType.Name, err))
+	c := cron.New(cron.WithLocation(schedulerLocation), cron.WithSeconds())
+
+	downloaders := map[string]*utils.ImageDownloader{mainCamera.Name: imageDownloader}
+	for _, camera := range extraCameras {
+		downloaders[camera.Name] = &utils.ImageDownloader{Url: propertyManager.GetProperty(fmt.Sprintf(constants.CameraImageUrl, camera.Name))}
+	}
+	for _, camera := range append([]jobs.Camera{mainCamera}, extraCameras...) {
+		movement := movementDetectorFor(camera)
+		for _, element := range downloadSchedules {
+			// images of mosaic-only cameras are only ever removed by a mosaic
+			if camera.MosaicOnly && !typeListed(constants.MosaicTypes, element.TimelapseType) {
+				continue
+			}
+			job := jobs.ImageDownloadJob{RootDirectory: camera.ImagesRootDirectory, TimelapseType: element.TimelapseType, ImageDownloader: downloaders[camera.Name], Ingest: ingestFor(camera, element.TimelapseType)}
+			if typeListed(constants.CameraMovementTypes, element.TimelapseType) {
+				job.Movement = movement
+			}
+			_, err := c.AddJob(element.string, job)
+			if err != nil {
+				log.Fatal(fmt.Sprintf("%s image job of camera %s not created due to %s", element.TimelapseType.Name, camera.Name, err))
+			}
 		}
 	}
+	makers := map[string]jobs.VideoMakerJob{}
 	for _, element := range videoJobs {
 		_, err := c.AddJob(element.string, element.VideoMakerJob)
 		if err != nil {
 			log.Fatal(fmt.Sprintf("%s video job not created due to %s", element.VideoMakerJob.TimelapseType.Name, err))
 		}
+		makers[element.VideoMakerJob.TimelapseType.Name] = element.VideoMakerJob
+	}
+	_, err := c.AddJob("30 * * * * *", jobs.RenderRetryJob{DBPool: dbPool, Backoff: renderBackoff, Makers: makers})
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Render retry job not created due to %s", err))
+	}
+	_, err = c.AddJob(propertyManager.GetStringProperty(constants.YearCompilationSchedule, "0 30 23 31 DEC ?"), yearCompilationJob)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("%s compilation job not created due to %s", constants.Year.Name, err))
+	}
+	var mosaicMakers []jobs.MosaicMakerJob
+	for _, element := range mosaicSchedules {
+		if len(extraCameras) == 0 || !typeListed(constants.MosaicTypes, element.TimelapseType) {
+			continue
+		}
+		maker := jobs.MosaicMakerJob{
+			Context:          shutdownContext,
+			RootDirectory:    videosBaseDirectory,
+			Cameras:          append([]jobs.Camera{mainCamera}, extraCameras...),
+			TimelapseType:    element.TimelapseType,
+			Columns:          propertyManager.GetIntProperty(constants.MosaicColumns, 2),
+			Tolerance:        propertyManager.GetDurationProperty(constants.MosaicTolerance, time.Minute),
+			DBPool:           dbPool,
+			Encoder:          encoderFor(element.TimelapseType),
+			ProgressListener: loggingProgressListener,
+			Queue:            renderQueue,
+		}
+		_, err = c.AddJob(element.string, maker)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("%s mosaic job not created due to %s", element.TimelapseType.Name, err))
+		}
+		mosaicMakers = append(mosaicMakers, maker)
+	}
+	if spec := propertyManager.GetStringProperty(constants.SeasonComparisonSchedule, ""); spec != "" {
+		_, err = c.AddJob(spec, seasonComparisonJob)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Season comparison job not created due to %s", err))
+		}
 	}
 
 	c.Start()
 
 	log.Print("Started...")
 
+	// mosaic catch-ups are queued first so that they run before the video
+	// catch-ups of the same periods archive the main camera's images
+	go func() {
+		for _, maker := range mosaicMakers {
+			maker.Reconcile(time.Now())
+		}
+		jobs.RenderReconciler{Makers: makers}.Run()
+	}()
+
+	if address := propertyManager.GetStringProperty(constants.MetricsAddress, ""); address != "" {
+		go serveMetrics(address)
+	}
+
 	wait := make(chan os.Signal, 1)
 	signal.Notify(wait, os.Interrupt, syscall.SIGTERM, os.Kill)
 
 	log.Printf("Got signal %s", <-wait)
 	log.Print("Exiting...")
+
+	shutdown()
+	<-c.Stop().Done()
+	renderQueue.Wait()
+	log.Print("Running jobs finished")
 }
 
 func initDataBasePool(dbURL string) *pgxpool.Pool {
@@ -93,12 +210,225 @@ func initDataBasePool(dbURL string) *pgxpool.Pool {
 	return pool
 }
 
-func byteCountSI(b uint32) string {
+// serveMetrics exposes expvar counters such as the render queue depth on
+// /debug/vars.
+func serveMetrics(address string) {
+	log.Printf("Serving metrics on %s", address)
+	if err := http.ListenAndServe(address, nil); err != nil {
+		log.Printf("Metrics server stopped: %v", err)
+	}
+}
+
+func initHlsSettings() *jobs.HlsSettings {
+	renditions, err := jobs.ParseHlsLadder(propertyManager.GetStringProperty(constants.HlsLadder, ""))
+	if err != nil {
+		log.Fatalf("Unable to parse HLS ladder: %v\n", err)
+	}
+	return &jobs.HlsSettings{
+		SegmentSeconds: propertyManager.GetIntProperty(constants.HlsSegmentSeconds, 6),
+		SegmentType:    propertyManager.GetStringProperty(constants.HlsSegmentType, "fmp4"),
+		Renditions:     renditions,
+	}
+}
+
+// configureProfile applies the optional fades and background audio configured
+// for the profile in app.properties.
+func configureProfile(profile *constants.EncodingProfile) {
+	profile.VideoFadeSeconds = propertyManager.GetFloatProperty(fmt.Sprintf(constants.ProfileVideoFade, profile.Name), 0)
+	file := propertyManager.GetStringProperty(fmt.Sprintf(constants.ProfileAudioFile, profile.Name), "")
+	directory := propertyManager.GetStringProperty(fmt.Sprintf(constants.ProfileAudioDir, profile.Name), "")
+	if file == "" && directory == "" {
+		return
+	}
+	profile.Audio = &constants.AudioSettings{
+		File:        file,
+		Directory:   directory,
+		FadeSeconds: propertyManager.GetFloatProperty(fmt.Sprintf(constants.ProfileAudioFade, profile.Name), 2),
+		Bitrate:     propertyManager.GetStringProperty(fmt.Sprintf(constants.ProfileAudioBitrate, profile.Name), "128k"),
+	}
+}
+
+func initExtraCameras() []jobs.Camera {
+	var cameras []jobs.Camera
+	for _, name := range strings.Split(propertyManager.GetStringProperty(constants.Cameras, ""), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		cameras = append(cameras, jobs.Camera{
+			Name:                name,
+			ImagesRootDirectory: filepath.Join(baseDirectory, "cameras", name, "images"),
+			MosaicOnly:          true,
+		})
+	}
+	return cameras
+}
+
+func initSeasonComparisonJob() jobs.SeasonComparisonJob {
+	timeOfDay, err := parseTimeOfDay(propertyManager.GetStringProperty(constants.SeasonComparisonTime, "12:00"))
+	if err != nil {
+		log.Fatalf("Unable to parse season comparison time: %v\n", err)
+	}
+	return jobs.SeasonComparisonJob{
+		Context:             shutdownContext,
+		RootDirectory:       videosBaseDirectory,
+		ImagesRootDirectory: imagesBaseDirectory,
+		DBPool:              dbPool,
+		Encoder:             jobs.FfmpegEncoder{Limits: renderLimits},
+		Limits:              renderLimits,
+		ProgressListener:    loggingProgressListener,
+		TimeOfDay:           timeOfDay,
+		Days:                propertyManager.GetIntProperty(constants.SeasonComparisonDays, 90),
+		CompareYears:        propertyManager.GetIntProperty(constants.SeasonComparisonCompareYears, 0),
+		Tolerance:           propertyManager.GetDurationProperty(constants.SeasonComparisonTolerance, 30*time.Minute),
+		Queue:               renderQueue,
+	}
+}
+
+func contactSheetFor(t *constants.TimelapseType) *jobs.ContactSheetSettings {
+	if !typeListed(constants.ContactSheetTypes, t) {
+		return nil
+	}
+	typeName := strings.ToLower(t.Name)
+	columns, rows, err := jobs.ParseContactSheetGrid(propertyManager.GetStringProperty(fmt.Sprintf(constants.ContactSheetGrid, typeName), "6x4"))
+	if err != nil {
+		log.Fatalf("Invalid contact sheet of %s: %v\n", t.Name, err)
+	}
+	return &jobs.ContactSheetSettings{
+		Columns:   columns,
+		Rows:      rows,
+		TileWidth: propertyManager.GetIntProperty(fmt.Sprintf(constants.ContactSheetTileWidth, typeName), 240),
+	}
+}
+
+func hlsFor(t *constants.TimelapseType) *jobs.HlsSettings {
+	if typeListed(constants.HlsTypes, t) {
+		return hlsSettings
+	}
+	return nil
+}
+
+func titleCardsFor(t *constants.TimelapseType) *jobs.TitleCardSettings {
+	if !typeListed(constants.TitleCardTypes, t) {
+		return nil
+	}
+	return &jobs.TitleCardSettings{
+		Seconds:    propertyManager.GetIntProperty(constants.TitleCardSeconds, 2),
+		OutroImage: propertyManager.GetStringProperty(constants.OutroImage, ""),
+	}
+}
+
+func highlightsFor(t *constants.TimelapseType) *jobs.HighlightSettings {
+	if !typeListed(constants.HighlightTypes, t) {
+		return nil
+	}
+	return &jobs.HighlightSettings{
+		Sensitivity: propertyManager.GetFloatProperty(constants.HighlightSensitivity, 3),
+		MinFrames:   propertyManager.GetIntProperty(constants.HighlightMinFrames, 3),
+		MergeFrames: propertyManager.GetIntProperty(constants.HighlightMergeFrames, 5),
+		MaxClips:    propertyManager.GetIntProperty(constants.HighlightMaxClips, 5),
+	}
+}
+
+func bestFramesFor(t *constants.TimelapseType) *jobs.BestFrameSettings {
+	if !typeListed(constants.BestFrameTypes, t) {
+		return nil
+	}
+	return &jobs.BestFrameSettings{
+		Bucket: propertyManager.GetDurationProperty(constants.BestFrameBucket, 10*time.Minute),
+	}
+}
+
+// ingestFor refuses to start with broken masks rather than store unmasked frames.
+// Crop and resize of a type override the ones of the camera.
+func ingestFor(camera jobs.Camera, t *constants.TimelapseType) jobs.FrameIngest {
+	masks, err := imaging.ParseMasks(propertyManager.GetStringProperty(fmt.Sprintf(constants.CameraMasks, camera.Name), ""))
+	if err != nil {
+		log.Fatalf("Invalid masks of camera %s: %v\n", camera.Name, err)
+	}
+	style := imaging.MaskStyle(propertyManager.GetStringProperty(fmt.Sprintf(constants.CameraMaskStyle, camera.Name), string(imaging.MaskBlack)))
+	if style != imaging.MaskBlack && style != imaging.MaskBlur {
+		log.Fatalf("Unknown mask style %s of camera %s\n", style, camera.Name)
+	}
+	typeName := strings.ToLower(t.Name)
+	cropSpec := propertyManager.GetStringProperty(fmt.Sprintf(constants.CameraTypeCrop, camera.Name, typeName),
+		propertyManager.GetStringProperty(fmt.Sprintf(constants.CameraCrop, camera.Name), ""))
+	crop, err := imaging.ParseRectangle(cropSpec)
+	if err != nil {
+		log.Fatalf("Invalid crop of camera %s for %s: %v\n", camera.Name, t.Name, err)
+	}
+	resizeSpec := propertyManager.GetStringProperty(fmt.Sprintf(constants.CameraTypeResize, camera.Name, typeName),
+		propertyManager.GetStringProperty(fmt.Sprintf(constants.CameraResize, camera.Name), ""))
+	width, height, err := imaging.ParseSize(resizeSpec)
+	if err != nil {
+		log.Fatalf("Invalid resize of camera %s for %s: %v\n", camera.Name, t.Name, err)
+	}
+	return jobs.FrameIngest{CameraName: camera.Name, Frames: frameStore, Masks: masks, MaskStyle: style, Crop: crop, Width: width, Height: height}
+}
+
+func movementDetectorFor(camera jobs.Camera) *jobs.CameraMovementDetector {
+	return &jobs.CameraMovementDetector{
+		CameraName:        camera.Name,
+		ReferenceFile:     jobs.ReferenceFramePath(camera.ImagesRootDirectory),
+		ShiftThreshold:    propertyManager.GetFloatProperty(constants.CameraMovementShift, 20),
+		RotationThreshold: propertyManager.GetFloatProperty(constants.CameraMovementRotation, 1),
+		WebhookUrl:        propertyManager.GetStringProperty(constants.CameraMovementWebhook, ""),
+	}
+}
+
+func coverageFor(t *constants.TimelapseType) *jobs.CoverageSettings {
+	if !typeListed(constants.CoverageTypes, t) {
+		return nil
+	}
+	for _, element := range downloadSchedules {
+		if element.TimelapseType != t {
+			continue
+		}
+		schedule, err := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor).Parse(element.string)
+		if err != nil {
+			log.Fatalf("Unable to parse download schedule of %s: %v\n", t.Name, err)
+		}
+		return &jobs.CoverageSettings{
+			Schedule:   schedule,
+			Location:   schedulerLocation,
+			Tolerance:  propertyManager.GetDurationProperty(constants.CoverageTolerance, time.Minute),
+			MaxGaps:    propertyManager.GetIntProperty(constants.CoverageMaxGaps, 5),
+			MinPercent: propertyManager.GetFloatProperty(constants.CoverageMinPercent, 0),
+		}
+	}
+	return nil
+}
+
+func encoderFor(t *constants.TimelapseType) jobs.Encoder {
+	encoder := jobs.FfmpegEncoder{Limits: renderLimits}
+	if !typeListed(constants.ChunkedEncodingTypes, t) {
+		return encoder
+	}
+	chunked, err := jobs.NewChunkedEncoder(renderLimits,
+		propertyManager.GetIntProperty(constants.ChunkedEncodingChunks, 4),
+		propertyManager.GetIntProperty(constants.ChunkedEncodingWorkers, 2),
+		propertyManager.GetIntProperty(constants.ChunkedEncodingMinFrames, 100))
+	if err != nil {
+		log.Fatalf("Invalid chunked encoding of %s: %v\n", t.Name, err)
+	}
+	return chunked
+}
+
+func typeListed(propertyName string, t *constants.TimelapseType) bool {
+	for _, name := range strings.Split(propertyManager.GetStringProperty(propertyName, ""), ",") {
+		if strings.TrimSpace(name) == t.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func byteCountSI(b uint64) string {
 	const unit = 1000
 	if b < unit {
 		return fmt.Sprintf("%d B", b)
 	}
-	div, exp := uint32(unit), 0
+	div, exp := uint64(unit), 0
 	for n := b / unit; n >= unit; n /= unit {
 		div *= unit
 		exp++
@@ -0,0 +1,97 @@
+CREATE SCHEMA IF NOT EXISTS "lig2";
+
+CREATE TABLE IF NOT EXISTS "lig2".videos
+(
+    id        BIGSERIAL PRIMARY KEY,
+    name      TEXT    NOT NULL,
+    type      TEXT    NOT NULL,
+    file_path TEXT    NOT NULL,
+    uploaded  BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+ALTER TABLE "lig2".videos
+    ADD COLUMN IF NOT EXISTS duration_seconds DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS frame_count      BIGINT,
+    ADD COLUMN IF NOT EXISTS codec            TEXT,
+    ADD COLUMN IF NOT EXISTS width            INTEGER,
+    ADD COLUMN IF NOT EXISTS height           INTEGER;
+
+CREATE TABLE IF NOT EXISTS "lig2".video_artifacts
+(
+    id        BIGSERIAL PRIMARY KEY,
+    video_id  BIGINT NOT NULL REFERENCES "lig2".videos (id),
+    kind      TEXT   NOT NULL,
+    file_path TEXT   NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "lig2".renders
+(
+    id              BIGSERIAL PRIMARY KEY,
+    type            TEXT        NOT NULL,
+    period          TEXT        NOT NULL,
+    state           TEXT        NOT NULL,
+    failed_state    TEXT,
+    reason          TEXT,
+    attempts        INTEGER     NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ,
+    video_id        BIGINT REFERENCES "lig2".videos (id),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (type, period)
+);
+
+CREATE TABLE IF NOT EXISTS "lig2".video_sources
+(
+    id       BIGSERIAL PRIMARY KEY,
+    video_id BIGINT NOT NULL REFERENCES "lig2".videos (id),
+    day      DATE   NOT NULL,
+    source   TEXT   NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "lig2".highlights
+(
+    id        BIGSERIAL PRIMARY KEY,
+    video_id  BIGINT           NOT NULL REFERENCES "lig2".videos (id),
+    file_path TEXT             NOT NULL,
+    starts_at TIMESTAMPTZ      NOT NULL,
+    ends_at   TIMESTAMPTZ      NOT NULL,
+    score     DOUBLE PRECISION NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "lig2".frames
+(
+    id                  BIGSERIAL PRIMARY KEY,
+    camera              TEXT             NOT NULL,
+    type                TEXT             NOT NULL,
+    period              TEXT             NOT NULL,
+    file_path           TEXT             NOT NULL UNIQUE,
+    captured_at         TIMESTAMPTZ      NOT NULL,
+    download_latency_ms BIGINT           NOT NULL,
+    byte_size           INTEGER          NOT NULL,
+    width               INTEGER          NOT NULL,
+    height              INTEGER          NOT NULL,
+    mean_luminance      DOUBLE PRECISION NOT NULL,
+    hash                TEXT             NOT NULL,
+    status              TEXT             NOT NULL,
+    video_id            BIGINT REFERENCES "lig2".videos (id)
+);
+
+CREATE INDEX IF NOT EXISTS frames_period_idx ON "lig2".frames (camera, type, period);
+
+CREATE TABLE IF NOT EXISTS "lig2".coverage_reports
+(
+    id               BIGSERIAL PRIMARY KEY,
+    video_id         BIGINT           NOT NULL UNIQUE REFERENCES "lig2".videos (id),
+    expected_slots   INTEGER          NOT NULL,
+    present_slots    INTEGER          NOT NULL,
+    coverage_percent DOUBLE PRECISION NOT NULL,
+    missing_slots    TIMESTAMPTZ[]    NOT NULL,
+    longest_gaps     JSONB            NOT NULL
+);
+
+ALTER TABLE "lig2".renders
+    ADD COLUMN IF NOT EXISTS forced BOOLEAN NOT NULL DEFAULT false;
+
+-- a render is driven by the process holding its claim until claimed_until
+ALTER TABLE "lig2".renders
+    ADD COLUMN IF NOT EXISTS claimed_by    TEXT,
+    ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMPTZ;
@@ -12,24 +12,24 @@ import (
 
 var httpClient = &http.Client{Timeout: time.Second * 10}
 
-var mutex = sync.Mutex{}
-
 var cachedDuration = time.Second * 30
-var cachedBytes []byte = nil
-var cachedTill = time.Now().Truncate(cachedDuration)
 
 type ImageDownloader struct {
 	Url            string
 	SocketTimeout  int
 	ConnectTimeout int
+
+	mutex       sync.Mutex
+	cachedBytes []byte
+	cachedTill  time.Time
 }
 
 func (c *ImageDownloader) DownloadAsByteArray() (*[]byte, error) {
-	mutex.Lock()
-	defer mutex.Unlock()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
 	now := time.Now()
-	if cachedBytes == nil || now.After(cachedTill) {
+	if c.cachedBytes == nil || now.After(c.cachedTill) {
 		log.Printf("GET to %s", c.Url)
 		response, err := httpClient.Get(c.Url)
 		if err != nil {
@@ -38,8 +38,8 @@ func (c *ImageDownloader) DownloadAsByteArray() (*[]byte, error) {
 		defer response.Body.Close()
 		if response.StatusCode == 200 {
 			bytes, err := ioutil.ReadAll(response.Body)
-			cachedBytes = bytes
-			cachedTill = now.Add(cachedDuration)
+			c.cachedBytes = bytes
+			c.cachedTill = now.Add(cachedDuration)
 
 			return &bytes, err
 		} else {
@@ -47,6 +47,6 @@ func (c *ImageDownloader) DownloadAsByteArray() (*[]byte, error) {
 		}
 	} else {
 		log.Print("Returning cached bytes")
-		return &cachedBytes, nil
+		return &c.cachedBytes, nil
 	}
 }
@@ -1,6 +1,9 @@
 package utils
 
-import "github.com/magiconair/properties"
+import (
+	"github.com/magiconair/properties"
+	"time"
+)
 
 var PropertyFiles = []string{"app.properties"}
 
@@ -17,3 +20,19 @@ func (res PropertyManager) GetProperty(propertyName string) string {
 		return get
 	}
 }
+
+func (res PropertyManager) GetIntProperty(propertyName string, defaultValue int) int {
+	return Props.GetInt(propertyName, defaultValue)
+}
+
+func (res PropertyManager) GetStringProperty(propertyName string, defaultValue string) string {
+	return Props.GetString(propertyName, defaultValue)
+}
+
+func (res PropertyManager) GetDurationProperty(propertyName string, defaultValue time.Duration) time.Duration {
+	return Props.GetParsedDuration(propertyName, defaultValue)
+}
+
+func (res PropertyManager) GetFloatProperty(propertyName string, defaultValue float64) float64 {
+	return Props.GetFloat64(propertyName, defaultValue)
+}